@@ -3,17 +3,21 @@ package cli
 import (
 	"bytes"
 	"net/http"
+	"os"
 
 	"github.com/spf13/cobra"
 )
 
 var client = &http.Client{}
 
-func HTTPGet(url string) (*http.Response, error) {
+func HTTPGet(url string, header http.Header) (*http.Response, error) {
 	request, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
+	for key, values := range header {
+		request.Header[key] = values
+	}
 	request.Header.Set("Content-Type", "application/json")
 	request.Header.Set("Accept", "application/json")
 	resp, err := client.Do(request)
@@ -24,12 +28,33 @@ func HTTPGet(url string) (*http.Response, error) {
 }
 
 func HTTPPost(url string, body *bytes.Buffer) (*http.Response, error) {
+	return HTTPPostContent(url, body, "application/json")
+}
+
+// HTTPPostContent posts a body of the given content type, such as a
+// multipart upload, and asks for a JSON response.
+func HTTPPostContent(url string, body *bytes.Buffer, contentType string) (*http.Response, error) {
 	request, err := http.NewRequest("POST", url, body)
 	if err != nil {
 		return nil, err
 	}
+	request.Header.Set("Content-Type", contentType)
+	request.Header.Set("Accept", "application/json")
+	resp, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func HTTPPatch(url string, body *bytes.Buffer, token string) (*http.Response, error) {
+	request, err := http.NewRequest("PATCH", url, body)
+	if err != nil {
+		return nil, err
+	}
 	request.Header.Set("Content-Type", "application/json")
 	request.Header.Set("Accept", "application/json")
+	request.Header.Set("Authorization", "Bearer "+token)
 	resp, err := client.Do(request)
 	if err != nil {
 		return nil, err
@@ -37,6 +62,28 @@ func HTTPPost(url string, body *bytes.Buffer) (*http.Response, error) {
 	return resp, nil
 }
 
+func HTTPDelete(url string, token string) (*http.Response, error) {
+	request, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("Authorization", "Bearer "+token)
+	resp, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func getBaseURL() string {
+	baseURL := os.Getenv("BINP_BASE_URL")
+	if baseURL == "" {
+		baseURL = "https://binp.io"
+	}
+	return baseURL
+}
+
 var rootCmd = &cobra.Command{
 	Use:   "binp",
 	Short: "A cli tool for the binp pastebin service",
@@ -1,92 +1,284 @@
 package cli
 
 import (
+	"binp/storage"
+	"binp/util"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/spf13/cobra"
 )
 
 type PostSnippetReq struct {
-	Text          string `json:"text"`
-	BurnAfterRead bool   `json:"burn_after_read"`
-	Language      string `json:"language"`
-	Expiry        string `json:"expiry"`
+	Text          string        `json:"text"`
+	BurnAfterRead bool          `json:"burn_after_read"`
+	Language      string        `json:"language"`
+	Expiry        string        `json:"expiry"`
+	Password      string        `json:"password,omitempty"`
+	Encryption    string        `json:"encryption,omitempty"`
+	ForkedFrom    string        `json:"forked_from,omitempty"`
+	Files         []SnippetFile `json:"files,omitempty"`
+}
+
+type SnippetFile struct {
+	Name     string `json:"name"`
+	Language string `json:"language,omitempty"`
+	Text     string `json:"text"`
 }
 
 type Snippet struct {
-	ID            string    `json:"id"`
-	Text          string    `json:"text"`
-	BurnAfterRead bool      `json:"burn_after_read"`
-	Language      string    `json:"language"`
-	CreatedAt     time.Time `json:"created_at"`
-	ExpiresAt     time.Time `json:"expires_at"`
+	ID            string        `json:"id"`
+	Text          string        `json:"text"`
+	BurnAfterRead bool          `json:"burn_after_read"`
+	Language      string        `json:"language"`
+	Encryption    string        `json:"encryption,omitempty"`
+	ForkedFrom    string        `json:"forked_from,omitempty"`
+	Files         []SnippetFile `json:"files,omitempty"`
+	Filename      string        `json:"filename,omitempty"`
+	MimeType      string        `json:"mime_type,omitempty"`
+	Token         string        `json:"token,omitempty"`
+	CreatedAt     time.Time     `json:"created_at"`
+	ExpiresAt     time.Time     `json:"expires_at"`
 }
 
 var createCmd = &cobra.Command{
-	Use:   "create",
-	Short: "Create a new snippet",
-	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		baseURL := os.Getenv("BINP_BASE_URL")
-		if baseURL == "" {
-			baseURL = "https://binp.io"
+	Use:   "create <text> | create -f <file> [-f <file>...]",
+	Short: "Create a new snippet, upload a file, or create a multi-file snippet from several files",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if paths, _ := cmd.Flags().GetStringArray("file"); len(paths) > 0 {
+			return cobra.NoArgs(cmd, args)
 		}
+		return cobra.ExactArgs(1)(cmd, args)
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		baseURL := getBaseURL()
 		language, _ := cmd.Flags().GetString("language")
 		expiry, _ := cmd.Flags().GetString("expiry")
 		burnAfterRead, _ := cmd.Flags().GetBool("burn")
-		text := args[0]
+		password, _ := cmd.Flags().GetString("password")
+		encrypt, _ := cmd.Flags().GetBool("encrypt")
+		paths, _ := cmd.Flags().GetStringArray("file")
+		lines, _ := cmd.Flags().GetString("lines")
 
-		snippetBody := &PostSnippetReq{
-			Text:          text,
-			BurnAfterRead: burnAfterRead,
-			Expiry:        expiry,
-			Language:      language,
+		var lineRange *util.LineRange
+		if lines != "" {
+			ranges := util.ParseLineRanges(lines)
+			if len(ranges) != 1 {
+				fmt.Fprintln(os.Stderr, "Error: Invalid line range. Use a line like 10 or a range like 10-20")
+				os.Exit(1)
+			}
+			if encrypt {
+				fmt.Fprintln(os.Stderr, "Error: Encrypted snippets keep their key in the URL fragment and cannot link to lines")
+				os.Exit(1)
+			}
+			lineRange = &ranges[0]
 		}
 
-		postBody, err := json.Marshal(snippetBody)
-		if err != nil {
+		if _, err := storage.ParseExpiration(expiry); err != nil {
 			fmt.Fprintln(os.Stderr, "Error: ", err)
 			os.Exit(1)
 		}
-		req := bytes.NewBuffer(postBody)
-		resp, err := HTTPPost(fmt.Sprintf("%s/snippet", baseURL), req)
-		if err != nil {
+
+		if err := validateLanguage(baseURL, language); err != nil {
 			fmt.Fprintln(os.Stderr, "Error: ", err)
 			os.Exit(1)
 		}
-		defer resp.Body.Close()
 
-		resBody, err := io.ReadAll(resp.Body)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error: ", err)
-			os.Exit(1)
+		if len(paths) == 1 {
+			if encrypt {
+				fmt.Fprintln(os.Stderr, "Error: Uploaded files cannot be encrypted")
+				os.Exit(1)
+			}
+			createdSnippet, err := uploadSnippet(baseURL, paths[0], &PostSnippetReq{
+				BurnAfterRead: burnAfterRead,
+				Expiry:        expiry,
+				Language:      language,
+				Password:      password,
+			})
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error: ", err)
+				os.Exit(1)
+			}
+			fmt.Println(snippetURL(baseURL, createdSnippet.ID, lineRange, util.LinePrefix))
+			os.Exit(0)
 		}
 
-		if resp.StatusCode != 201 {
-			fmt.Fprintln(os.Stderr, "Error: ", string(resBody))
-			os.Exit(1)
+		text := ""
+		if len(args) > 0 {
+			text = args[0]
+		}
+
+		snippetBody := &PostSnippetReq{
+			Text:          text,
+			BurnAfterRead: burnAfterRead,
+			Expiry:        expiry,
+			Language:      language,
+			Password:      password,
 		}
 
-		createdSnippet := &Snippet{}
-		err = json.Unmarshal(resBody, createdSnippet)
+		linePrefix := util.LinePrefix
+		if len(paths) > 1 {
+			if encrypt {
+				fmt.Fprintln(os.Stderr, "Error: Multi-file snippets cannot be encrypted")
+				os.Exit(1)
+			}
+			files, err := readSnippetFiles(paths)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error: ", err)
+				os.Exit(1)
+			}
+			snippetBody.Text = ""
+			snippetBody.Language = ""
+			snippetBody.Files = files
+			linePrefix = storage.FileLinePrefix(files[0].Name)
+		}
+
+		key := ""
+		if encrypt {
+			ciphertext, encryptionKey, err := encryptText(text)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error: ", err)
+				os.Exit(1)
+			}
+			snippetBody.Text = ciphertext
+			snippetBody.Encryption = storage.EncryptionAES256GCM
+			key = encryptionKey
+		}
+
+		createdSnippet, err := postSnippet(baseURL, snippetBody)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "Error: ", err)
 			os.Exit(1)
 		}
 
-		fmt.Println(fmt.Sprintf("%s/%s", baseURL, createdSnippet.ID))
+		if key != "" {
+			fmt.Println(fmt.Sprintf("%s/%s#%s", baseURL, createdSnippet.ID, key))
+		} else {
+			fmt.Println(snippetURL(baseURL, createdSnippet.ID, lineRange, linePrefix))
+		}
 		os.Exit(0)
 	},
 }
 
+// snippetURL is the URL of a snippet, linking to a range of its lines when
+// lines is set. The line anchors of multi-file snippets have a file prefix.
+func snippetURL(baseURL string, id string, lines *util.LineRange, prefix string) string {
+	if lines == nil {
+		return fmt.Sprintf("%s/%s", baseURL, id)
+	}
+	return fmt.Sprintf("%s/%s#%s", baseURL, id, url.PathEscape(lines.Anchor(prefix)))
+}
+
+// readSnippetFiles reads the files of a multi-file snippet. Each file is
+// named after its base name and the server detects its language.
+func readSnippetFiles(paths []string) ([]SnippetFile, error) {
+	files := make([]SnippetFile, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, SnippetFile{Name: filepath.Base(path), Text: string(data)})
+	}
+	return files, nil
+}
+
+// postSnippet creates a snippet and saves its management token.
+func postSnippet(baseURL string, snippetBody *PostSnippetReq) (*Snippet, error) {
+	postBody, err := json.Marshal(snippetBody)
+	if err != nil {
+		return nil, err
+	}
+	return sendSnippet(baseURL, bytes.NewBuffer(postBody), "application/json")
+}
+
+// uploadSnippet creates a snippet from a file with a multipart upload, which
+// keeps its name and MIME type, and saves its management token.
+func uploadSnippet(baseURL string, path string, options *PostSnippetReq) (*Snippet, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	fields := map[string]string{
+		"expiry":          options.Expiry,
+		"language":        options.Language,
+		"password":        options.Password,
+		"burn_after_read": strconv.FormatBool(options.BurnAfterRead),
+	}
+	for name, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := writer.WriteField(name, value); err != nil {
+			return nil, err
+		}
+	}
+	part, err := writer.CreateFormFile("file", filepath.Base(path))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return sendSnippet(baseURL, body, writer.FormDataContentType())
+}
+
+// sendSnippet posts a snippet body and saves the management token of the
+// created snippet.
+func sendSnippet(baseURL string, body *bytes.Buffer, contentType string) (*Snippet, error) {
+	resp, err := HTTPPostContent(fmt.Sprintf("%s/snippet", baseURL), body, contentType)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	resBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != 201 {
+		return nil, errors.New(string(resBody))
+	}
+
+	createdSnippet := &Snippet{}
+	if err := json.Unmarshal(resBody, createdSnippet); err != nil {
+		return nil, err
+	}
+
+	if createdSnippet.Token != "" {
+		if err := saveToken(baseURL, createdSnippet.ID, createdSnippet.Token); err != nil {
+			fmt.Fprintln(os.Stderr, "Warning: could not save snippet token: ", err)
+			fmt.Fprintln(os.Stderr, "Token: ", createdSnippet.Token)
+		}
+	}
+	return createdSnippet, nil
+}
+
 func init() {
-	createCmd.Flags().StringP("language", "l", "txt", "The language of the snippet")
-	createCmd.Flags().StringP("expiry", "e", "1m", "The expiry time of the snippet. Valid values: %v")
+	createCmd.Flags().StringP("language", "l", storage.LanguageAuto, "The language of the snippet, detected from its content by default")
+	createCmd.Flags().StringP("expiry", "e", "1m", "The expiry of the snippet: a duration (30m, 7d, 2w, P1D), an RFC 3339 timestamp or never")
 	createCmd.Flags().BoolP("burn-after-read", "b", false, "Burn the snippet after reading it once")
+	createCmd.Flags().StringP("password", "P", "", "Require a password to read the snippet")
+	createCmd.Flags().BoolP("encrypt", "E", false, "Encrypt the snippet locally, the key is only kept in the printed URL")
+	createCmd.Flags().StringArrayP("file", "f", nil, "Upload a file, keeping its name and MIME type, or repeat it to create a multi-file snippet")
+	createCmd.Flags().String("lines", "", "Print a URL highlighting a line or range of lines, like 10-20")
+	createCmd.RegisterFlagCompletionFunc("language", completeLanguages)
 	rootCmd.AddCommand(createCmd)
 }
@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"binp/storage"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// encryptText seals text with a fresh AES-256-GCM key in the same format as
+// the web UI: base64(iv || ciphertext || tag), with the key as unpadded
+// base64url for the URL fragment.
+func encryptText(text string) (ciphertext string, key string, err error) {
+	rawKey := make([]byte, 32)
+	if _, err := rand.Read(rawKey); err != nil {
+		return "", "", err
+	}
+	gcm, err := newGCM(rawKey)
+	if err != nil {
+		return "", "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(text), nil)
+	return base64.StdEncoding.EncodeToString(sealed), base64.RawURLEncoding.EncodeToString(rawKey), nil
+}
+
+func decryptText(ciphertext string, key string) (string, error) {
+	rawKey, err := base64.RawURLEncoding.DecodeString(key)
+	if err != nil {
+		return "", errors.New("invalid encryption key")
+	}
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", storage.ErrInvalidCiphertext
+	}
+	gcm, err := newGCM(rawKey)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", storage.ErrInvalidCiphertext
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("failed to decrypt snippet, check the key")
+	}
+	return string(plain), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// parseSnippetRef accepts either a bare snippet ID or a full snippet URL,
+// returning the base URL to use, the ID and the key from the fragment.
+func parseSnippetRef(ref string) (baseURL string, id string, key string, err error) {
+	if !strings.Contains(ref, "://") {
+		id, key, _ = strings.Cut(ref, "#")
+		return getBaseURL(), id, key, nil
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return "", "", "", err
+	}
+	id = u.Path[strings.LastIndex(u.Path, "/")+1:]
+	if id == "" {
+		return "", "", "", errors.New("snippet URL has no ID")
+	}
+	baseURL = u.Scheme + "://" + u.Host + strings.TrimSuffix(u.Path[:len(u.Path)-len(id)], "/")
+	return baseURL, id, u.Fragment, nil
+}
@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var deleteCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "Delete a snippet you created",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		baseURL := getBaseURL()
+		tokenFlag, _ := cmd.Flags().GetString("token")
+		ID := args[0]
+
+		token, err := resolveToken(tokenFlag, baseURL, ID)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: ", err)
+			os.Exit(1)
+		}
+
+		resp, err := HTTPDelete(fmt.Sprintf("%s/%s", baseURL, ID), token)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: ", err)
+			os.Exit(1)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 204 {
+			resBody, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode == 404 {
+				fmt.Fprintln(os.Stderr, "Error: Snippet not found")
+			} else {
+				fmt.Fprintln(os.Stderr, "Error: ", string(resBody))
+			}
+			os.Exit(1)
+		}
+
+		if err := forgetToken(baseURL, ID); err != nil {
+			fmt.Fprintln(os.Stderr, "Warning: could not forget snippet token: ", err)
+		}
+
+		fmt.Println("Deleted", ID)
+		os.Exit(0)
+	},
+}
+
+func init() {
+	deleteCmd.Flags().StringP("token", "t", "", "The management token of the snippet (defaults to the saved token)")
+	rootCmd.AddCommand(deleteCmd)
+}
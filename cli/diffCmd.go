@@ -0,0 +1,165 @@
+package cli
+
+import (
+	"binp/storage"
+	"binp/util"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <id|url>[@revision] <id|url>[@revision]",
+	Short: "Show a unified diff between two snippets or revisions",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		confirm, _ := cmd.Flags().GetBool("confirm")
+		password, _ := cmd.Flags().GetString("password")
+
+		header := http.Header{}
+		if password != "" {
+			header.Set("X-Snippet-Password", password)
+		}
+
+		baseA, refA, keyA, err := parseDiffRef(args[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: ", err)
+			os.Exit(1)
+		}
+		baseB, refB, keyB, err := parseDiffRef(args[1])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: ", err)
+			os.Exit(1)
+		}
+
+		// The server cannot read encrypted snippets, so those are fetched
+		// and diffed locally.
+		if keyA != "" || keyB != "" || baseA != baseB {
+			a := fetchSnippet(baseA, refA, keyA, header)
+			b := fetchSnippet(baseB, refB, keyB, header)
+			err := checkDiffable(refA, a)
+			if err == nil {
+				err = checkDiffable(refB, b)
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error: ", err)
+				os.Exit(1)
+			}
+			fmt.Print(util.UnifiedDiff(refA, refB, util.DiffLines(a.Text, b.Text), 3))
+			os.Exit(0)
+		}
+
+		url := fmt.Sprintf("%s/diff/%s/%s.diff", baseA, refA, refB)
+		if confirm {
+			url += "?confirm=true"
+		}
+		resp, err := HTTPGet(url, header)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: ", err)
+			os.Exit(1)
+		}
+		defer resp.Body.Close()
+
+		resBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: ", err)
+			os.Exit(1)
+		}
+
+		if resp.StatusCode != 200 {
+			if resp.StatusCode == 409 {
+				fmt.Fprintln(os.Stderr, "Error: The diff includes a burn-after-read snippet. Pass --confirm to read and burn it")
+			} else if resp.StatusCode == 401 && password == "" {
+				fmt.Fprintln(os.Stderr, "Error: Snippet is password protected. Pass it with --password")
+			} else {
+				fmt.Fprintln(os.Stderr, "Error: ", strings.TrimSpace(string(resBody)))
+			}
+			os.Exit(1)
+		}
+
+		fmt.Print(string(resBody))
+		os.Exit(0)
+	},
+}
+
+// parseDiffRef splits a diff argument into the base URL, the <id>[@revision]
+// reference and the encryption key.
+func parseDiffRef(arg string) (string, string, string, error) {
+	ref, key, _ := strings.Cut(arg, "#")
+	ref, rev, hasRev := strings.Cut(ref, "@")
+	baseURL, id, _, err := parseSnippetRef(ref)
+	if err != nil {
+		return "", "", "", err
+	}
+	if hasRev {
+		id += "@" + rev
+	}
+	return baseURL, id, key, nil
+}
+
+// checkDiffable rejects the snippets the server refuses to diff: binary
+// uploads and multi-file snippets.
+func checkDiffable(ref string, snippet *Snippet) error {
+	if snippet.MimeType != "" && !storage.IsTextMIME(snippet.MimeType) {
+		return fmt.Errorf("Snippet %s is a binary file and cannot be diffed", ref)
+	}
+	if len(snippet.Files) > 0 {
+		return fmt.Errorf("Snippet %s has multiple files and cannot be diffed", ref)
+	}
+	return nil
+}
+
+// fetchSnippet downloads and, given a key, decrypts a snippet or a revision
+// referenced as <id>@<revision>. It exits on failure.
+func fetchSnippet(baseURL, ref, key string, header http.Header) *Snippet {
+	url := fmt.Sprintf("%s/%s", baseURL, ref)
+	if id, rev, ok := strings.Cut(ref, "@"); ok {
+		url = fmt.Sprintf("%s/%s/rev/%s", baseURL, id, rev)
+	}
+	resp, err := HTTPGet(url, header)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: ", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	resBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: ", err)
+		os.Exit(1)
+	}
+	if resp.StatusCode != 200 {
+		fmt.Fprintln(os.Stderr, "Error: ", ref, strings.TrimSpace(string(resBody)))
+		os.Exit(1)
+	}
+
+	snippet := &Snippet{}
+	if err := json.Unmarshal(resBody, snippet); err != nil {
+		fmt.Fprintln(os.Stderr, "Error: ", err)
+		os.Exit(1)
+	}
+	if snippet.Encryption == "" {
+		return snippet
+	}
+	if key == "" {
+		fmt.Fprintln(os.Stderr, "Error: Snippet", ref, "is encrypted. Pass the full URL including its #key")
+		os.Exit(1)
+	}
+	snippet.Text, err = decryptText(snippet.Text, key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: ", err)
+		os.Exit(1)
+	}
+	return snippet
+}
+
+func init() {
+	diffCmd.Flags().BoolP("confirm", "y", false, "Allow diffing, and so burning, burn-after-read snippets")
+	diffCmd.Flags().StringP("password", "P", "", "The password of protected snippets")
+	rootCmd.AddCommand(diffCmd)
+}
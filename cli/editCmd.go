@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"binp/storage"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+type PatchSnippetReq struct {
+	Text          *string `json:"text,omitempty"`
+	BurnAfterRead *bool   `json:"burn_after_read,omitempty"`
+	Language      *string `json:"language,omitempty"`
+	Expiry        *string `json:"expiry,omitempty"`
+}
+
+var editCmd = &cobra.Command{
+	Use:   "edit",
+	Short: "Edit a snippet you created",
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		baseURL := getBaseURL()
+		tokenFlag, _ := cmd.Flags().GetString("token")
+		ID := args[0]
+
+		patch := &PatchSnippetReq{}
+		if len(args) == 2 {
+			patch.Text = &args[1]
+		}
+		if cmd.Flags().Changed("language") {
+			language, _ := cmd.Flags().GetString("language")
+			if err := validateLanguage(baseURL, language); err != nil {
+				fmt.Fprintln(os.Stderr, "Error: ", err)
+				os.Exit(1)
+			}
+			patch.Language = &language
+		}
+		if cmd.Flags().Changed("expiry") {
+			expiry, _ := cmd.Flags().GetString("expiry")
+			if _, err := storage.ParseExpiration(expiry); err != nil {
+				fmt.Fprintln(os.Stderr, "Error: ", err)
+				os.Exit(1)
+			}
+			patch.Expiry = &expiry
+		}
+		if cmd.Flags().Changed("burn-after-read") {
+			burnAfterRead, _ := cmd.Flags().GetBool("burn-after-read")
+			patch.BurnAfterRead = &burnAfterRead
+		}
+		if patch.Text == nil && patch.Language == nil && patch.Expiry == nil && patch.BurnAfterRead == nil {
+			fmt.Fprintln(os.Stderr, "Error: Nothing to edit. Pass new text or a flag")
+			os.Exit(1)
+		}
+
+		token, err := resolveToken(tokenFlag, baseURL, ID)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: ", err)
+			os.Exit(1)
+		}
+
+		patchBody, err := json.Marshal(patch)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: ", err)
+			os.Exit(1)
+		}
+		resp, err := HTTPPatch(fmt.Sprintf("%s/%s", baseURL, ID), bytes.NewBuffer(patchBody), token)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: ", err)
+			os.Exit(1)
+		}
+		defer resp.Body.Close()
+
+		resBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: ", err)
+			os.Exit(1)
+		}
+
+		if resp.StatusCode != 200 {
+			if resp.StatusCode == 404 {
+				fmt.Fprintln(os.Stderr, "Error: Snippet not found")
+			} else {
+				fmt.Fprintln(os.Stderr, "Error: ", string(resBody))
+			}
+			os.Exit(1)
+		}
+
+		fmt.Println(fmt.Sprintf("%s/%s", baseURL, ID))
+		os.Exit(0)
+	},
+}
+
+func init() {
+	editCmd.Flags().StringP("token", "t", "", "The management token of the snippet (defaults to the saved token)")
+	editCmd.Flags().StringP("language", "l", "", "The new language of the snippet")
+	editCmd.RegisterFlagCompletionFunc("language", completeLanguages)
+	editCmd.Flags().StringP("expiry", "e", "", "The new expiry of the snippet: a duration (30m, 7d, 2w, P1D), an RFC 3339 timestamp or never")
+	editCmd.Flags().BoolP("burn-after-read", "b", false, "Burn the snippet after reading it once")
+	rootCmd.AddCommand(editCmd)
+}
@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"binp/storage"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var forkCmd = &cobra.Command{
+	Use:   "fork <id|url>",
+	Short: "Create a new snippet from a copy of an existing one",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		expiry, _ := cmd.Flags().GetString("expiry")
+		burnAfterRead, _ := cmd.Flags().GetBool("burn-after-read")
+		password, _ := cmd.Flags().GetString("password")
+		newPassword, _ := cmd.Flags().GetString("new-password")
+
+		baseURL, ID, key, err := parseSnippetRef(args[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: ", err)
+			os.Exit(1)
+		}
+
+		if _, err := storage.ParseExpiration(expiry); err != nil {
+			fmt.Fprintln(os.Stderr, "Error: ", err)
+			os.Exit(1)
+		}
+
+		header := http.Header{}
+		if password != "" {
+			header.Set("X-Snippet-Password", password)
+		}
+		parent := fetchSnippet(baseURL, ID, key, header)
+
+		language := parent.Language
+		if cmd.Flags().Changed("language") {
+			language, _ = cmd.Flags().GetString("language")
+			if err := validateLanguage(baseURL, language); err != nil {
+				fmt.Fprintln(os.Stderr, "Error: ", err)
+				os.Exit(1)
+			}
+		}
+
+		snippetBody := &PostSnippetReq{
+			Text:          parent.Text,
+			BurnAfterRead: burnAfterRead,
+			Expiry:        expiry,
+			Language:      language,
+			Password:      newPassword,
+			ForkedFrom:    parent.ID,
+		}
+		if len(parent.Files) > 0 {
+			snippetBody.Text = ""
+			snippetBody.Language = ""
+			snippetBody.Files = parent.Files
+		}
+
+		// Forks of encrypted snippets are encrypted again with a new key.
+		newKey := ""
+		if parent.Encryption != "" {
+			snippetBody.Text, newKey, err = encryptText(parent.Text)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error: ", err)
+				os.Exit(1)
+			}
+			snippetBody.Encryption = storage.EncryptionAES256GCM
+		}
+
+		createdSnippet, err := postSnippet(baseURL, snippetBody)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: ", err)
+			os.Exit(1)
+		}
+
+		if newKey != "" {
+			fmt.Println(fmt.Sprintf("%s/%s#%s", baseURL, createdSnippet.ID, newKey))
+		} else {
+			fmt.Println(fmt.Sprintf("%s/%s", baseURL, createdSnippet.ID))
+		}
+		os.Exit(0)
+	},
+}
+
+func init() {
+	forkCmd.Flags().StringP("language", "l", "", "The language of the fork (default: the language of the original)")
+	forkCmd.RegisterFlagCompletionFunc("language", completeLanguages)
+	forkCmd.Flags().StringP("expiry", "e", "1m", "The expiry of the fork: a duration (30m, 7d, 2w, P1D), an RFC 3339 timestamp or never")
+	forkCmd.Flags().BoolP("burn-after-read", "b", false, "Burn the fork after reading it once")
+	forkCmd.Flags().StringP("password", "P", "", "The password of the original snippet, if it is protected")
+	forkCmd.Flags().String("new-password", "", "Require a password to read the fork")
+	rootCmd.AddCommand(forkCmd)
+}
@@ -1,42 +1,60 @@
 package cli
 
 import (
-	"bytes"
+	"binp/storage"
+	"binp/util"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
 
 var getCmd = &cobra.Command{
-	Use:   "get",
+	Use:   "get <id|url>",
 	Short: "Get a snippet",
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		baseURL := os.Getenv("BINP_BASE_URL")
-		if baseURL == "" {
-			baseURL = "https://binp.io"
-		}
 		prettyPrint, _ := cmd.Flags().GetBool("pretty-print")
 		jsonPrint, _ := cmd.Flags().GetBool("json")
-		ID := args[0]
+		password, _ := cmd.Flags().GetString("password")
+		outputDir, _ := cmd.Flags().GetString("output")
+		color, _ := cmd.Flags().GetString("color")
+		theme, _ := cmd.Flags().GetString("theme")
+		baseURL, ID, key, err := parseSnippetRef(args[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: ", err)
+			os.Exit(1)
+		}
 
 		if prettyPrint && jsonPrint {
 			fmt.Fprintln(os.Stderr, "Error: Cannot use both pretty-print and json flags")
 			os.Exit(1)
 		}
 
-		if prettyPrint {
-			if _, err := exec.LookPath("bat"); err != nil {
-				fmt.Fprintln(os.Stderr, "Error: Pretty print requires bat. Please install bat.")
-				os.Exit(1)
-			}
+		if _, err := terminalFormatter(color); err != nil {
+			fmt.Fprintln(os.Stderr, "Error: ", err)
+			os.Exit(1)
+		}
+
+		if theme != "" && !util.IsValidTheme(theme) {
+			fmt.Fprintf(os.Stderr, "Error: Unknown theme %q\n", theme)
+			os.Exit(1)
 		}
 
-		resp, err := HTTPGet(fmt.Sprintf("%s/%s", baseURL, ID))
+		header := http.Header{}
+		if password != "" {
+			header.Set("X-Snippet-Password", password)
+		}
+		resp, err := HTTPGet(fmt.Sprintf("%s/%s", baseURL, ID), header)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: ", err)
+			os.Exit(1)
+		}
 		defer resp.Body.Close()
 
 		resBody, err := io.ReadAll(resp.Body)
@@ -48,6 +66,8 @@ var getCmd = &cobra.Command{
 		if resp.StatusCode != 200 {
 			if resp.StatusCode == 404 {
 				fmt.Fprintln(os.Stderr, "Error: Snippet not found")
+			} else if resp.StatusCode == 401 && password == "" {
+				fmt.Fprintln(os.Stderr, "Error: Snippet is password protected. Pass it with --password")
 			} else {
 				fmt.Fprintln(os.Stderr, "Error: ", string(resBody))
 			}
@@ -66,18 +86,32 @@ var getCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		if !prettyPrint {
-			fmt.Println(snippet.Text)
-			os.Exit(0)
+		if snippet.Encryption != "" {
+			if key == "" {
+				fmt.Fprintln(os.Stderr, "Error: Snippet is encrypted. Pass the full URL including its #key")
+				os.Exit(1)
+			}
+			snippet.Text, err = decryptText(snippet.Text, key)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error: ", err)
+				os.Exit(1)
+			}
 		}
 
-		batCmd := exec.Command("bat", "-l", snippet.Language, "--file-name", snippet.ID)
-		batCmd.Stdin = bytes.NewBufferString(snippet.Text)
-		batCmd.Stdout = os.Stdout
-		batCmd.Stderr = os.Stderr
+		if snippet.MimeType != "" && !storage.IsTextMIME(snippet.MimeType) {
+			fmt.Fprintf(os.Stderr, "Error: %s is a binary file. Download it from %s/dl/%s\n", snippet.Filename, baseURL, snippet.ID)
+			os.Exit(1)
+		}
 
-		err = batCmd.Run()
-		if err != nil {
+		if outputDir != "" {
+			if err := restoreSnippetFiles(snippet, outputDir); err != nil {
+				fmt.Fprintln(os.Stderr, "Error: ", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
+
+		if err := printSnippet(snippet, prettyPrint, color, theme); err != nil {
 			fmt.Fprintln(os.Stderr, "Error: ", err)
 			os.Exit(1)
 		}
@@ -86,8 +120,67 @@ var getCmd = &cobra.Command{
 	},
 }
 
+// printSnippet prints the text of a snippet, or every file of a multi-file
+// snippet under a header naming it, like `tail` does.
+func printSnippet(snippet *Snippet, prettyPrint bool, color, theme string) error {
+	files := snippet.Files
+	if len(files) == 0 {
+		files = []SnippetFile{{Text: snippet.Text, Language: snippet.Language}}
+	}
+	for i, file := range files {
+		if file.Name != "" {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("==> %s <==\n", file.Name)
+		}
+		if !prettyPrint {
+			fmt.Print(file.Text)
+			if !strings.HasSuffix(file.Text, "\n") {
+				fmt.Println()
+			}
+			continue
+		}
+		if err := printHighlighted(file.Text, file.Language, color, theme); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreSnippetFiles writes the files of a snippet to dir. An uploaded file
+// keeps its name and any other single-text snippet is written as <id> with
+// the extension of its language.
+func restoreSnippetFiles(snippet *Snippet, dir string) error {
+	files := snippet.Files
+	if len(files) == 0 {
+		name := snippet.Filename
+		if name == "" {
+			name = snippet.ID + util.LanguageExtension(snippet.Language)
+		}
+		files = []SnippetFile{{Name: name, Text: snippet.Text}}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, file := range files {
+		path := filepath.Join(dir, filepath.Base(file.Name))
+		if err := os.WriteFile(path, []byte(file.Text), 0644); err != nil {
+			return err
+		}
+		fmt.Println(path)
+	}
+	return nil
+}
+
 func init() {
-	getCmd.Flags().BoolP("pretty-print", "p", false, "Pretty print snippet (requires bat)")
+	getCmd.Flags().BoolP("pretty-print", "p", false, "Pretty print snippet with syntax highlighting")
 	getCmd.Flags().BoolP("json", "j", false, "Print snippet as JSON")
+	getCmd.Flags().StringP("password", "P", "", "The password of a protected snippet")
+	getCmd.Flags().StringP("output", "o", "", "Write the snippet's files to this directory")
+	getCmd.Flags().String("color", colorAuto, "When to color pretty printed output: auto, always or never")
+	getCmd.Flags().String("theme", "", "The syntax theme of pretty printed output (default: DARK_THEME or tokyonight-night)")
+	getCmd.RegisterFlagCompletionFunc("color", completeColors)
+	getCmd.RegisterFlagCompletionFunc("theme", completeThemes)
 	rootCmd.AddCommand(getCmd)
 }
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"binp/util"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+)
+
+// Values of the --color flag.
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+// terminalFormatter returns the chroma terminal formatter for stdout, or ""
+// when output should not be colored. In auto mode colors are only used on a
+// terminal and when NO_COLOR is unset.
+func terminalFormatter(mode string) (string, error) {
+	switch mode {
+	case colorNever:
+		return "", nil
+	case colorAlways:
+		return terminalColors(), nil
+	case colorAuto, "":
+		if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+			return "", nil
+		}
+		fd := os.Stdout.Fd()
+		if !isatty.IsTerminal(fd) && !isatty.IsCygwinTerminal(fd) {
+			return "", nil
+		}
+		return terminalColors(), nil
+	}
+	return "", fmt.Errorf("invalid color %q. Use auto, always or never", mode)
+}
+
+// terminalColors guesses the color depth of the terminal from COLORTERM and
+// TERM, the same way most command line tools do.
+func terminalColors() string {
+	switch strings.ToLower(os.Getenv("COLORTERM")) {
+	case "truecolor", "24bit":
+		return util.TerminalTrueColor
+	}
+	if os.Getenv("WT_SESSION") != "" {
+		return util.TerminalTrueColor
+	}
+	if strings.Contains(os.Getenv("TERM"), "256color") {
+		return util.Terminal256
+	}
+	return util.Terminal16
+}
+
+// printHighlighted writes text to stdout, highlighted as language when
+// stdout supports it.
+func printHighlighted(text, language, color, theme string) error {
+	formatter, err := terminalFormatter(color)
+	if err != nil {
+		return err
+	}
+	if formatter == "" {
+		fmt.Println(text)
+		return nil
+	}
+	highlighted, err := util.HighlightTerminal(text, language, formatter, theme)
+	if err != nil {
+		return err
+	}
+	fmt.Print(highlighted)
+	if !strings.HasSuffix(text, "\n") {
+		fmt.Println()
+	}
+	return nil
+}
+
+func completeColors(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return []string{colorAuto, colorAlways, colorNever}, cobra.ShellCompDirectiveNoFileComp
+}
+
+func completeThemes(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return util.ThemeNames()[1:], cobra.ShellCompDirectiveNoFileComp
+}
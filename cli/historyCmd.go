@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type Revision struct {
+	Revision   int       `json:"revision"`
+	Text       string    `json:"text"`
+	Language   string    `json:"language"`
+	Encryption string    `json:"encryption,omitempty"`
+	Editor     string    `json:"editor"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+var historyCmd = &cobra.Command{
+	Use:   "history <id|url> [revision]",
+	Short: "List the revisions of a snippet, or print one of them",
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		password, _ := cmd.Flags().GetString("password")
+		baseURL, ID, key, err := parseSnippetRef(args[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: ", err)
+			os.Exit(1)
+		}
+
+		url := fmt.Sprintf("%s/%s/history", baseURL, ID)
+		if len(args) == 2 {
+			if _, err := strconv.Atoi(args[1]); err != nil {
+				fmt.Fprintln(os.Stderr, "Error: Invalid revision", args[1])
+				os.Exit(1)
+			}
+			url = fmt.Sprintf("%s/%s/rev/%s", baseURL, ID, args[1])
+		}
+
+		header := http.Header{}
+		if password != "" {
+			header.Set("X-Snippet-Password", password)
+		}
+		resp, err := HTTPGet(url, header)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: ", err)
+			os.Exit(1)
+		}
+		defer resp.Body.Close()
+
+		resBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: ", err)
+			os.Exit(1)
+		}
+
+		if resp.StatusCode != 200 {
+			if resp.StatusCode == 404 {
+				fmt.Fprintln(os.Stderr, "Error: Snippet or revision not found")
+			} else if resp.StatusCode == 401 && password == "" {
+				fmt.Fprintln(os.Stderr, "Error: Snippet is password protected. Pass it with --password")
+			} else {
+				fmt.Fprintln(os.Stderr, "Error: ", string(resBody))
+			}
+			os.Exit(1)
+		}
+
+		if len(args) == 2 {
+			revision := &Revision{}
+			if err := json.Unmarshal(resBody, revision); err != nil {
+				fmt.Fprintln(os.Stderr, "Error: ", err)
+				os.Exit(1)
+			}
+			text := revision.Text
+			if revision.Encryption != "" {
+				if key == "" {
+					fmt.Fprintln(os.Stderr, "Error: Snippet is encrypted. Pass the full URL including its #key")
+					os.Exit(1)
+				}
+				text, err = decryptText(text, key)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, "Error: ", err)
+					os.Exit(1)
+				}
+			}
+			fmt.Println(text)
+			os.Exit(0)
+		}
+
+		history := struct {
+			Revisions []Revision `json:"revisions"`
+		}{}
+		if err := json.Unmarshal(resBody, &history); err != nil {
+			fmt.Fprintln(os.Stderr, "Error: ", err)
+			os.Exit(1)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "REVISION\tDATE\tLANGUAGE\tEDITOR")
+		for _, revision := range history.Revisions {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", revision.Revision, revision.CreatedAt.Local().Format(time.DateTime), revision.Language, revision.Editor)
+		}
+		w.Flush()
+		os.Exit(0)
+	},
+}
+
+func init() {
+	historyCmd.Flags().StringP("password", "P", "", "The password of a protected snippet")
+	rootCmd.AddCommand(historyCmd)
+}
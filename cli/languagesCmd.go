@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"binp/storage"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+type Language struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Aliases   []string `json:"aliases,omitempty"`
+	Filenames []string `json:"filenames,omitempty"`
+	Popular   bool     `json:"popular,omitempty"`
+}
+
+// matches reports whether value names the language by its ID, name, an
+// alias or a file extension, ignoring case as the server does.
+func (l Language) matches(value string) bool {
+	value = strings.ToLower(value)
+	if value == l.ID || value == strings.ToLower(l.Name) {
+		return true
+	}
+	for _, alias := range l.Aliases {
+		if value == strings.ToLower(alias) {
+			return true
+		}
+	}
+	for _, glob := range l.Filenames {
+		if glob == "*."+value {
+			return true
+		}
+	}
+	return false
+}
+
+var languagesCmd = &cobra.Command{
+	Use:   "languages [search]",
+	Short: "List the languages snippets can be highlighted as",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		popular, _ := cmd.Flags().GetBool("popular")
+		languages, err := fetchLanguages(getBaseURL())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: ", err)
+			os.Exit(1)
+		}
+
+		search := ""
+		if len(args) == 1 {
+			search = strings.ToLower(args[0])
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tALIASES")
+		for _, language := range languages {
+			if popular && !language.Popular {
+				continue
+			}
+			if search != "" && !strings.Contains(language.ID, search) && !strings.Contains(strings.ToLower(language.Name), search) && !language.matches(search) {
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", language.ID, language.Name, strings.Join(language.Aliases, ", "))
+		}
+		w.Flush()
+		os.Exit(0)
+	},
+}
+
+// fetchLanguages lists the languages supported by the server.
+func fetchLanguages(baseURL string) ([]Language, error) {
+	resp, err := HTTPGet(fmt.Sprintf("%s/api/languages", baseURL), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	resBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, errors.New(string(resBody))
+	}
+
+	var languages []Language
+	if err := json.Unmarshal(resBody, &languages); err != nil {
+		return nil, err
+	}
+	return languages, nil
+}
+
+// validateLanguage checks a language flag against the server's languages
+// before anything is sent. Servers that cannot list their languages are
+// left to reject it themselves.
+func validateLanguage(baseURL string, language string) error {
+	if language == "" || language == storage.LanguageAuto {
+		return nil
+	}
+	languages, err := fetchLanguages(baseURL)
+	if err != nil {
+		return nil
+	}
+	for _, l := range languages {
+		if l.matches(language) {
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown language %q. Run `binp languages` to list them", language)
+}
+
+// completeLanguages completes language flags with the IDs of the server's
+// languages.
+func completeLanguages(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	languages, err := fetchLanguages(getBaseURL())
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var completions []string
+	for _, language := range languages {
+		if strings.HasPrefix(language.ID, strings.ToLower(toComplete)) {
+			completions = append(completions, language.ID+"\t"+language.Name)
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+func init() {
+	languagesCmd.Flags().Bool("popular", false, "Only list the languages offered first in the web UI")
+	rootCmd.AddCommand(languagesCmd)
+}
@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// Management tokens are kept in <user config dir>/binp/tokens.json, keyed by
+// snippet URL.
+
+func tokensPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "binp", "tokens.json"), nil
+}
+
+func loadTokens() (map[string]string, error) {
+	path, err := tokensPath()
+	if err != nil {
+		return nil, err
+	}
+	tokens := make(map[string]string)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return tokens, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func writeTokens(tokens map[string]string) error {
+	path, err := tokensPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+func saveToken(baseURL, id, token string) error {
+	tokens, err := loadTokens()
+	if err != nil {
+		return err
+	}
+	tokens[baseURL+"/"+id] = token
+	return writeTokens(tokens)
+}
+
+func forgetToken(baseURL, id string) error {
+	tokens, err := loadTokens()
+	if err != nil {
+		return err
+	}
+	delete(tokens, baseURL+"/"+id)
+	return writeTokens(tokens)
+}
+
+// resolveToken returns the --token flag if set, otherwise the token saved
+// when the snippet was created.
+func resolveToken(flag, baseURL, id string) (string, error) {
+	if flag != "" {
+		return flag, nil
+	}
+	tokens, err := loadTokens()
+	if err != nil {
+		return "", err
+	}
+	token, ok := tokens[baseURL+"/"+id]
+	if !ok {
+		return "", errors.New("no saved token for this snippet. Pass one with --token")
+	}
+	return token, nil
+}
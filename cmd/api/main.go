@@ -5,7 +5,9 @@ import (
 	"binp/server"
 	"binp/storage"
 	"binp/util"
+	"context"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -25,6 +27,16 @@ func main() {
 		logger.Fatal().Err(err).Msg("Failed to initalize store")
 	}
 
+	syncInterval := 2 * time.Second
+	if value := os.Getenv("CACHE_SYNC_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval <= 0 {
+			logger.Fatal().Err(err).Str("CACHE_SYNC_INTERVAL", value).Msg("Invalid cache sync interval")
+		}
+		syncInterval = interval
+	}
+	go store.WatchChanges(context.Background(), syncInterval)
+
 	runner := scheduler.NewScheduler()
 	runner.AddFunc("@hourly", func() {
 		logger.Info().Msg("Checking for expired snippets...")
@@ -39,6 +51,14 @@ func main() {
 	logger.Info().Msg("Scheduler started!")
 
 	serv := server.NewServer(store)
+	if tcpPort := os.Getenv("TCP_PORT"); tcpPort != "" {
+		go func() {
+			logger.Info().Str("port", tcpPort).Msg("Starting TCP listener...")
+			if err := serv.StartTCP(tcpPort); err != nil {
+				logger.Fatal().Err(err).Msg("Failed to start TCP listener")
+			}
+		}()
+	}
 	logger.Info().Str("port", os.Getenv("PORT")).Msg("Server created. Starting...")
 	if err := serv.Start(os.Getenv("PORT")); err != nil {
 		logger.Fatal().Err(err).Msg("Failed to start server")
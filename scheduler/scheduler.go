@@ -4,6 +4,7 @@ import (
 	"binp/storage"
 	"binp/util"
 	"context"
+	"time"
 
 	"github.com/robfig/cron/v3"
 )
@@ -28,6 +29,24 @@ func (s *Scheduler) Init(store *storage.Store) {
 		}
 		logger.Info().Int("count", count).Msg("Expired snippets deleted")
 	})
+	s.AddFunc("@daily", func() {
+		logger.Info().Msg("Pruning snippet change log...")
+		count, err := store.PruneChanges(24 * time.Hour)
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to prune snippet change log")
+			return
+		}
+		logger.Info().Int("count", count).Msg("Snippet change log pruned")
+	})
+	s.AddFunc("@hourly", func() {
+		logger.Info().Str("version", util.HighlightVersion()).Msg("Re-highlighting stale snippets...")
+		count, err := store.RehighlightSnippets()
+		if err != nil {
+			logger.Error().Err(err).Int("count", count).Msg("Failed to re-highlight snippets")
+			return
+		}
+		logger.Info().Int("count", count).Msg("Stale snippets re-highlighted")
+	})
 }
 
 func (s *Scheduler) Start() {
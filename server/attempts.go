@@ -0,0 +1,67 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	passwordAttemptBurst    = 5
+	passwordAttemptInterval = time.Minute
+	passwordAttemptTTL      = 15 * time.Minute
+)
+
+// attemptLimiter throttles failed password attempts per snippet, so a
+// snippet cannot be brute forced from many addresses at once.
+type attemptLimiter struct {
+	mu          sync.Mutex
+	attempts    map[string]*attempt
+	lastCleanup time.Time
+}
+
+type attempt struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newAttemptLimiter() *attemptLimiter {
+	return &attemptLimiter{
+		attempts:    make(map[string]*attempt),
+		lastCleanup: time.Now(),
+	}
+}
+
+// Blocked reports whether too many attempts have failed recently for id.
+func (l *attemptLimiter) Blocked(id string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	a, ok := l.attempts[id]
+	if !ok {
+		return false
+	}
+	return a.limiter.Tokens() < 1
+}
+
+// Fail records a failed attempt for id.
+func (l *attemptLimiter) Fail(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Sub(l.lastCleanup) > passwordAttemptTTL {
+		for key, a := range l.attempts {
+			if now.Sub(a.lastSeen) > passwordAttemptTTL {
+				delete(l.attempts, key)
+			}
+		}
+		l.lastCleanup = now
+	}
+	a, ok := l.attempts[id]
+	if !ok {
+		a = &attempt{limiter: rate.NewLimiter(rate.Every(passwordAttemptInterval), passwordAttemptBurst)}
+		l.attempts[id] = a
+	}
+	a.lastSeen = now
+	a.limiter.Allow()
+}
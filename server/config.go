@@ -0,0 +1,85 @@
+package server
+
+import (
+	"binp/storage"
+	"binp/util"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// defaultLanguage is used for snippets created without a language, such as
+// plain-body uploads. It is configured through DEFAULT_LANGUAGE and detects
+// the language by default.
+func defaultLanguage() string {
+	if language := os.Getenv("DEFAULT_LANGUAGE"); language != "" {
+		return language
+	}
+	return storage.LanguageAuto
+}
+
+// defaultExpiry is used for snippets created without an expiry. It is
+// configured through DEFAULT_EXPIRY.
+func defaultExpiry() string {
+	if expiry := os.Getenv("DEFAULT_EXPIRY"); expiry != "" {
+		return expiry
+	}
+	return "1d"
+}
+
+// baseURL is the public URL of the server, used where there is no HTTP
+// request to derive it from. It is configured through BINP_BASE_URL.
+func baseURL() string {
+	if url := os.Getenv("BINP_BASE_URL"); url != "" {
+		return strings.TrimSuffix(url, "/")
+	}
+	return fmt.Sprintf("http://localhost:%s", os.Getenv("PORT"))
+}
+
+// publicURL is the public URL of the server as seen by a request: baseURL
+// when BINP_BASE_URL is set, or else the URL the request was sent to.
+func publicURL(c echo.Context) string {
+	if os.Getenv("BINP_BASE_URL") != "" {
+		return baseURL()
+	}
+	return c.Scheme() + "://" + c.Request().Host
+}
+
+// maxUploadSize is the largest file accepted by a multipart upload, in
+// bytes. It is configured through MAX_UPLOAD_SIZE and defaults to 1 MiB.
+func maxUploadSize() int64 {
+	if size, err := strconv.ParseInt(os.Getenv("MAX_UPLOAD_SIZE"), 10, 64); err == nil && size > 0 {
+		return size
+	}
+	return 1 << 20
+}
+
+// tcpMaxConnections is how many TCP pastes are read at once. It is
+// configured through TCP_MAX_CONNECTIONS and defaults to 64.
+func tcpMaxConnections() int {
+	if n, err := strconv.Atoi(os.Getenv("TCP_MAX_CONNECTIONS")); err == nil && n > 0 {
+		return n
+	}
+	return 64
+}
+
+// allowBinaryUploads reports whether uploads that are not text are stored,
+// as a download without highlighting, instead of being rejected. It is
+// configured through ALLOW_BINARY_UPLOADS.
+func allowBinaryUploads() bool {
+	allow, _ := strconv.ParseBool(os.Getenv("ALLOW_BINARY_UPLOADS"))
+	return allow
+}
+
+// defaultTheme is the syntax theme of visitors who have not picked one. It is
+// configured through DEFAULT_THEME and follows the browser's color scheme by
+// default.
+func defaultTheme() string {
+	if theme := os.Getenv("DEFAULT_THEME"); util.IsValidTheme(theme) {
+		return theme
+	}
+	return util.ThemeAuto
+}
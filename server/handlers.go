@@ -4,135 +4,758 @@ import (
 	"binp/storage"
 	"binp/util"
 	"binp/views"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"html/template"
+	"io"
+	"mime"
 	"net/http"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/labstack/echo/v4"
 )
 
 type PostSnippetReq struct {
-	Text          string `form:"text" json:"text" validate:"required,min=1,max=10000"`
-	BurnAfterRead bool   `form:"burn_after_read" json:"burn_after_read"`
-	Language      string `form:"language" json:"language" validate:"required"`
-	Expiry        string `form:"expiry" json:"expiry" validate:"required"`
+	Text          string            `form:"text" json:"text" validate:"required_without=Files"`
+	BurnAfterRead bool              `form:"burn_after_read" json:"burn_after_read"`
+	Language      string            `form:"language" json:"language"`
+	Expiry        string            `form:"expiry" json:"expiry" validate:"required_without=ExpiresAt"`
+	ExpiresAt     string            `form:"expires_at" json:"expires_at"`
+	Password      string            `form:"password" json:"password"`
+	Encryption    string            `form:"encryption" json:"encryption"`
+	Encrypt       bool              `form:"encrypt" json:"-"`
+	ForkedFrom    string            `form:"forked_from" json:"forked_from"`
+	Files         []PostSnippetFile `json:"files" validate:"omitempty,max=20,dive"`
+}
+
+type PostSnippetFile struct {
+	Name     string `json:"name" validate:"required,max=255"`
+	Language string `json:"language"`
+	Text     string `json:"text" validate:"required"`
+}
+
+// snippetFiles validates the files of a multi-file snippet. The store
+// detects the language of files that do not set one. The first file becomes
+// the text and language of the snippet.
+func snippetFiles(data *PostSnippetReq) ([]storage.SnippetFile, error) {
+	if data.Encryption != "" {
+		return nil, fmt.Errorf("Encrypted snippets cannot have multiple files")
+	}
+	files := make([]storage.SnippetFile, len(data.Files))
+	for i, file := range data.Files {
+		language := file.Language
+		if !isValidLanguageOrAuto(language) {
+			return nil, fmt.Errorf("Invalid language for %s. See /api/languages for the options", file.Name)
+		}
+		if err := validateSnippetText(file.Text, ""); err != nil {
+			return nil, fmt.Errorf("%s: %w", file.Name, err)
+		}
+		files[i] = storage.SnippetFile{Name: file.Name, Language: language, Text: file.Text}
+	}
+	if err := storage.ValidateFiles(files); err != nil {
+		return nil, err
+	}
+	data.Text = files[0].Text
+	data.Language = files[0].Language
+	return files, nil
+}
+
+// snippetUpload is a file sent in the file field of a multipart request.
+type snippetUpload struct {
+	Filename string
+	MimeType string
+	Data     []byte
+}
+
+// Binary reports whether the upload is stored as a download only.
+func (u *snippetUpload) Binary() bool {
+	return !storage.IsTextMIME(u.MimeType)
+}
+
+// readUpload reads the file field of a multipart request, or returns nil if
+// there is none. Binary files are rejected unless ALLOW_BINARY_UPLOADS is
+// set. Errors are safe to show to the client and come with the status to
+// respond with.
+func readUpload(c echo.Context) (*snippetUpload, int, error) {
+	header, err := c.FormFile("file")
+	if errors.Is(err, http.ErrMissingFile) {
+		return nil, http.StatusOK, nil
+	}
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("Invalid upload")
+	}
+	limit := maxUploadSize()
+	if header.Size > limit {
+		return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("File must be at most %d bytes", limit)
+	}
+	file, err := header.Open()
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("Invalid upload")
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, limit+1))
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("Invalid upload")
+	}
+	if int64(len(data)) > limit {
+		return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("File must be at most %d bytes", limit)
+	}
+	if len(data) == 0 {
+		return nil, http.StatusBadRequest, fmt.Errorf("File is empty")
+	}
+
+	filename := filepath.Base(header.Filename)
+	if filename == "." || filename == string(filepath.Separator) || utf8.RuneCountInString(filename) > 255 {
+		filename = "upload"
+	}
+	upload := &snippetUpload{
+		Filename: filename,
+		MimeType: storage.DetectMIMEType(filename, data),
+		Data:     data,
+	}
+	if upload.Binary() && !allowBinaryUploads() {
+		return nil, http.StatusUnsupportedMediaType, fmt.Errorf("Binary files are not allowed")
+	}
+	return upload, http.StatusOK, nil
+}
+
+// isValidLanguageOrAuto reports whether a new snippet may be created with
+// language. An empty language or "auto" is detected by the store.
+func isValidLanguageOrAuto(language string) bool {
+	return language == "" || language == storage.LanguageAuto || storage.IsValidLanguage(language)
+}
+
+// maxTextLength is the character limit for snippet text. Encrypted snippets
+// hold base64 ciphertext, so their limit also covers the IV, tag and encoding.
+const maxTextLength = 10000
+
+// validateSnippetText checks the text length and, for encrypted snippets,
+// the encryption scheme and ciphertext shape.
+func validateSnippetText(text, encryption string) error {
+	if !storage.IsValidEncryption(encryption) {
+		return fmt.Errorf("Invalid encryption. Options: %q", storage.EncryptionAES256GCM)
+	}
+	limit := maxTextLength
+	if encryption != "" {
+		limit = base64.StdEncoding.EncodedLen(maxTextLength + 28)
+	}
+	if utf8.RuneCountInString(text) > limit {
+		return fmt.Errorf("Text must be at most %d characters", maxTextLength)
+	}
+	return storage.ValidateCiphertext(encryption, text)
+}
+
+// validatePassword checks that a password fits bcrypt, whose limit is in
+// bytes rather than characters.
+func validatePassword(password string) error {
+	if len(password) > storage.MaxPasswordBytes {
+		return fmt.Errorf("Password must be at most %d bytes", storage.MaxPasswordBytes)
+	}
+	return nil
 }
 
 func (s *Server) HandleGetIndex(c echo.Context) error {
-	return Render(c, http.StatusOK, views.Index())
+	return Render(c, http.StatusOK, views.Index(nil))
 }
 
-func (s *Server) HandleGetSnippet(c echo.Context) error {
+// HandleGetLanguages lists every supported language, for clients like the
+// CLI to validate and complete language names.
+func (s *Server) HandleGetLanguages(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "public, max-age=3600")
+	return c.JSON(http.StatusOK, storage.Languages())
+}
+
+// HandleGetThemeCSS serves the CSS of a theme that chroma.css was not
+// generated with, at /themes/<name>.css.
+func (s *Server) HandleGetThemeCSS(c echo.Context) error {
+	name, ok := strings.CutSuffix(c.Param("theme"), ".css")
+	if !ok || name == util.ThemeAuto || !util.IsValidTheme(name) {
+		return c.String(http.StatusNotFound, "Theme not found\n")
+	}
+	c.Response().Header().Set("Cache-Control", "public, max-age=86400")
+	return c.Blob(http.StatusOK, "text/css; charset=utf-8", []byte(util.ThemeCSS(name)))
+}
+
+// resolveSnippet loads a snippet for reading. Expired snippets are deleted,
+// password-protected snippets must be unlocked and burn-after-read snippets
+// are consumed, so callers must serve the returned snippet exactly once. The
+// status is http.StatusOK on success, and otherwise the status the caller
+// should respond with.
+func (s *Server) resolveSnippet(c echo.Context, id string) (*storage.Snippet, int) {
+	snippet, status := s.authorizeSnippet(c, id)
+	if status != http.StatusOK {
+		return nil, status
+	}
+	return s.burnSnippet(c, snippet)
+}
+
+// authorizeSnippet performs the checks of resolveSnippet without burning the
+// snippet, for handlers that must read more data before it is consumed.
+func (s *Server) authorizeSnippet(c echo.Context, id string) (*storage.Snippet, int) {
 	logger := util.GetLoggerWithRequestID(c)
-	id := c.Param("id")
-	contentType := c.Request().Header.Get("Content-Type")
 
 	snippet, err := s.store.GetSnippetByID(id)
 	if err != nil {
 		logger.Error().Str("ID", id).Err(err).Msg("Error while getting snippet")
-		if strings.HasPrefix(contentType, "application/json") {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
-		} else {
-			return Render(c, http.StatusInternalServerError, views.ErrorPage())
-		}
+		return nil, http.StatusInternalServerError
 	}
 
 	if snippet == nil {
 		logger.Warn().Str("ID", id).Msg("Snippet not found")
-		if strings.HasPrefix(contentType, "application/json") {
-			return c.JSON(http.StatusNotFound, map[string]string{"error": "Snippet not found"})
-		} else {
-			return Render(c, http.StatusNotFound, views.NotFoundPage())
-		}
+		return nil, http.StatusNotFound
 	}
 
 	logger.Debug().Str("ID", id).Interface("snippet", snippet).Msg("Snippet found")
-	if snippet.ExpiresAt.Before(time.Now().UTC()) {
+	if snippet.IsExpired() {
 		logger.Warn().Str("ID", id).Msg("Snippet expired")
-		err = s.store.DeleteSnippet(snippet.ID)
-		if err != nil {
+		if err := s.store.DeleteSnippet(snippet.ID); err != nil {
 			logger.Error().Str("ID", id).Err(err).Msg("Error while deleting expired snippet")
-			if strings.HasPrefix(contentType, "application/json") {
-				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
-			} else {
-				return Render(c, http.StatusInternalServerError, views.ErrorPage())
+			return nil, http.StatusInternalServerError
+		}
+		return nil, http.StatusNotFound
+	}
+
+	if snippet.IsProtected() {
+		if s.attempts.Blocked(id) {
+			logger.Warn().Str("ID", id).Msg("Too many failed password attempts")
+			return nil, http.StatusTooManyRequests
+		}
+		password := snippetPassword(c)
+		if !snippet.VerifyPassword(password) {
+			if password != "" {
+				logger.Warn().Str("ID", id).Msg("Invalid snippet password")
+				s.attempts.Fail(id)
 			}
+			return nil, http.StatusUnauthorized
 		}
-		if strings.HasPrefix(contentType, "application/json") {
-			return c.JSON(http.StatusNotFound, map[string]string{"error": "Snippet not found"})
-		} else {
-			return Render(c, http.StatusNotFound, views.NotFoundPage())
+	}
+
+	return snippet, http.StatusOK
+}
+
+// burnSnippet consumes an authorized burn-after-read snippet, returning
+// http.StatusNotFound if another reader got to it first. Other snippets are
+// returned as is.
+func (s *Server) burnSnippet(c echo.Context, snippet *storage.Snippet) (*storage.Snippet, int) {
+	if !snippet.BurnAfterRead {
+		return snippet, http.StatusOK
+	}
+
+	logger := util.GetLoggerWithRequestID(c)
+	id := snippet.ID
+	snippet, err := s.store.ConsumeSnippet(id)
+	if err != nil {
+		logger.Error().Str("ID", id).Err(err).Msg("Error while burning snippet")
+		return nil, http.StatusInternalServerError
+	}
+	if snippet == nil {
+		logger.Warn().Str("ID", id).Msg("Snippet already burned")
+		return nil, http.StatusNotFound
+	}
+	logger.Info().Str("ID", id).Msg("Burned snippet")
+	return snippet, http.StatusOK
+}
+
+// snippetPassword reads the password of a protected snippet from the
+// X-Snippet-Password header, the submitted form or the query string.
+func snippetPassword(c echo.Context) string {
+	if password := c.Request().Header.Get("X-Snippet-Password"); password != "" {
+		return password
+	}
+	return c.FormValue("password")
+}
+
+// snippetErrorMessage describes a failed resolveSnippet status.
+func snippetErrorMessage(c echo.Context, status int) string {
+	switch status {
+	case http.StatusNotFound:
+		return "Snippet not found"
+	case http.StatusUnauthorized:
+		if snippetPassword(c) != "" {
+			return "Invalid password"
 		}
+		return "Password required"
+	case http.StatusTooManyRequests:
+		return "Too many failed password attempts. Try again later"
+	default:
+		return "Internal server error"
 	}
+}
 
-	if snippet.BurnAfterRead {
-		logger.Info().Str("ID", id).Msg("Burned snippet")
-		err = s.store.DeleteSnippet(snippet.ID)
-		if err != nil {
-			logger.Error().Str("ID", id).Err(err).Msg("Error while deleting burned snippet")
-			if strings.HasPrefix(contentType, "application/json") {
-				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
-			} else {
-				return Render(c, http.StatusInternalServerError, views.ErrorPage())
-			}
+func renderSnippetError(c echo.Context, status int) error {
+	contentType := c.Request().Header.Get("Content-Type")
+	accept := c.Request().Header.Get("Accept")
+	message := snippetErrorMessage(c, status)
+	if strings.HasPrefix(contentType, "application/json") || strings.Contains(accept, "application/json") {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+	switch status {
+	case http.StatusNotFound:
+		return Render(c, http.StatusNotFound, views.NotFoundPage())
+	case http.StatusUnauthorized, http.StatusTooManyRequests:
+		if status == http.StatusUnauthorized && snippetPassword(c) == "" {
+			message = ""
 		}
+		return Render(c, status, views.PasswordPage(c.Request().URL.Path, message))
+	default:
+		return Render(c, http.StatusInternalServerError, views.ErrorPage())
+	}
+}
+
+// HandleGetSnippet renders a snippet. The language query parameter views it
+// highlighted as another language without changing it, and hl marks lines
+// like 10-20. Terminal clients can ask for ANSI output instead, and a .svg
+// or .png suffix on the ID returns an image of the snippet.
+func (s *Server) HandleGetSnippet(c echo.Context) error {
+	if id, format, ok := imageRef(c.Param("id")); ok {
+		return s.serveSnippetImage(c, id, format)
+	}
+	if wantsANSI(c) {
+		return s.serveSnippetANSI(c)
+	}
+	snippet, status := s.resolveSnippet(c, c.Param("id"))
+	if status != http.StatusOK {
+		return renderSnippetError(c, status)
+	}
+
+	language := snippet.Language
+	if normalized, ok := storage.NormalizeLanguage(c.QueryParam("language")); ok {
+		language = normalized
+	}
+	lines := util.ParseLineRanges(c.QueryParam("hl"))
+	if (language != snippet.Language || len(lines) > 0) && len(snippet.Files) == 0 {
+		snippet = storage.HighlightAs(snippet, language, lines)
 	}
 
 	accept := c.Request().Header.Get("Accept")
 	if strings.Contains(accept, "application/json") {
 		return c.JSON(http.StatusOK, snippet)
 	} else {
+		req := c.Request()
+		c.SetRequest(req.WithContext(views.WithBaseURL(req.Context(), publicURL(c))))
 		return Render(c, http.StatusOK, views.SnippetPage(snippet))
 	}
 }
 
+// Image formats of snippets, by their suffix on the snippet ID.
+var imageTypes = map[string]string{
+	".svg": "image/svg+xml",
+	".png": "image/png",
+}
+
+// imageRef splits a snippet ID with an image suffix, like abc.svg, into the
+// ID and the suffix.
+func imageRef(ref string) (string, string, bool) {
+	for format := range imageTypes {
+		if id, ok := strings.CutSuffix(ref, format); ok {
+			return id, format, true
+		}
+	}
+	return "", "", false
+}
+
+// imageOptions reads the options of a snippet image from the query string:
+// font_size, padding and line_numbers. The theme is the one pages are
+// rendered with.
+func imageOptions(c echo.Context) (util.ImageOptions, error) {
+	options := util.DefaultImageOptions()
+	options.Theme = views.ThemeFrom(c.Request().Context())
+	if value := c.QueryParam("font_size"); value != "" {
+		size, err := strconv.ParseFloat(value, 64)
+		if err != nil || size < util.MinImageFontSize || size > util.MaxImageFontSize {
+			return options, fmt.Errorf("font_size must be between %d and %d", util.MinImageFontSize, util.MaxImageFontSize)
+		}
+		options.FontSize = size
+	}
+	if value := c.QueryParam("padding"); value != "" {
+		padding, err := strconv.Atoi(value)
+		if err != nil || padding < 0 || padding > util.MaxImagePadding {
+			return options, fmt.Errorf("padding must be between 0 and %d", util.MaxImagePadding)
+		}
+		options.Padding = padding
+	}
+	if value := c.QueryParam("line_numbers"); value != "" {
+		lineNumbers, err := strconv.ParseBool(value)
+		if err != nil {
+			return options, fmt.Errorf("line_numbers must be true or false")
+		}
+		options.LineNumbers = lineNumbers
+	}
+	return options, nil
+}
+
+// serveSnippetImage writes an image of a snippet, or of the first file of a
+// multi-file snippet, in the format of suffix.
+func (s *Server) serveSnippetImage(c echo.Context, id string, suffix string) error {
+	options, err := imageOptions(c)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error()+"\n")
+	}
+	snippet, status := s.resolveSnippet(c, id)
+	if status != http.StatusOK {
+		return c.String(status, snippetErrorMessage(c, status)+"\n")
+	}
+	return s.writeSnippetImage(c, snippet, suffix, options)
+}
+
+// HandleGetSnippetPreview writes the OpenGraph preview image of a snippet.
+// Burn-after-read snippets have none, so that unfurling a link does not burn
+// it.
+func (s *Server) HandleGetSnippetPreview(c echo.Context) error {
+	snippet, status := s.authorizeSnippet(c, c.Param("id"))
+	if status == http.StatusOK && snippet.BurnAfterRead {
+		status = http.StatusNotFound
+	}
+	if status != http.StatusOK {
+		return c.String(status, snippetErrorMessage(c, status)+"\n")
+	}
+	options := util.PreviewImageOptions(views.ThemeFrom(c.Request().Context()))
+	return s.writeSnippetImage(c, snippet, ".png", options)
+}
+
+func (s *Server) writeSnippetImage(c echo.Context, snippet *storage.Snippet, suffix string, options util.ImageOptions) error {
+	logger := util.GetLoggerWithRequestID(c)
+
+	if snippet.IsEncrypted() {
+		return c.String(http.StatusNotAcceptable, "Snippet is encrypted. Use the CLI to decrypt it\n")
+	}
+	if snippet.IsBinary() {
+		return c.String(http.StatusNotAcceptable, "Binary file, not shown. Download it from /dl/"+snippet.ID+"\n")
+	}
+
+	render := util.RenderSVG
+	if suffix == ".png" {
+		render = util.RenderPNG
+	}
+	data, err := render(snippet.Text, snippet.Language, options)
+	if err != nil {
+		logger.Error().Str("ID", snippet.ID).Err(err).Msg("Error while rendering snippet image")
+		return c.String(http.StatusInternalServerError, "Internal server error\n")
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, imageTypes[suffix])
+	res.Header().Set("X-Content-Type-Options", "nosniff")
+	if snippet.BurnAfterRead {
+		res.Header().Set("Cache-Control", "no-store")
+		return c.Blob(http.StatusOK, imageTypes[suffix], data)
+	}
+	res.Header().Set("ETag", textETag(snippet.Language, fmt.Sprintf("%s\x00%+v\x00%s", suffix, options, snippet.Text)))
+	res.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(res, c.Request(), "", snippet.UpdatedAt, bytes.NewReader(data))
+	return nil
+}
+
+// ansiMIME is the media type of snippets highlighted for a terminal.
+const ansiMIME = "text/x-ansi"
+
+// wantsANSI reports whether the client asked for a snippet highlighted with
+// ANSI escape codes, through Accept: text/x-ansi or ?format=ansi.
+func wantsANSI(c echo.Context) bool {
+	return c.QueryParam("format") == "ansi" || strings.Contains(c.Request().Header.Get("Accept"), ansiMIME)
+}
+
+// serveSnippetANSI writes a snippet highlighted for a terminal, in 256 colors
+// unless the colors query parameter asks for 16 or truecolor. The files of a
+// multi-file snippet follow each other under their names. Encrypted
+// snippets and binary uploads cannot be highlighted by the server.
+func (s *Server) serveSnippetANSI(c echo.Context) error {
+	logger := util.GetLoggerWithRequestID(c)
+
+	formatter := util.Terminal256
+	if colors := c.QueryParam("colors"); colors != "" {
+		var ok bool
+		if formatter, ok = util.ParseTerminalColors(colors); !ok {
+			return c.String(http.StatusBadRequest, "Invalid colors. Use 16, 256 or truecolor\n")
+		}
+	}
+
+	snippet, status := s.resolveSnippet(c, c.Param("id"))
+	if status != http.StatusOK {
+		return c.String(status, snippetErrorMessage(c, status)+"\n")
+	}
+	if snippet.IsEncrypted() {
+		return c.String(http.StatusNotAcceptable, "Snippet is encrypted. Use the CLI to decrypt it\n")
+	}
+	if snippet.IsBinary() {
+		return c.String(http.StatusNotAcceptable, "Binary file, not shown. Download it from /dl/"+snippet.ID+"\n")
+	}
+
+	files := snippet.Files
+	if len(files) == 0 {
+		language := snippet.Language
+		if normalized, ok := storage.NormalizeLanguage(c.QueryParam("language")); ok {
+			language = normalized
+		}
+		files = []storage.SnippetFile{{Text: snippet.Text, Language: language}}
+	}
+	theme := views.ThemeFrom(c.Request().Context())
+	var out strings.Builder
+	for i, file := range files {
+		if file.Name != "" {
+			if i > 0 {
+				out.WriteString("\n")
+			}
+			fmt.Fprintf(&out, "\x1b[1m==> %s <==\x1b[0m\n", file.Name)
+		}
+		highlighted, err := util.HighlightTerminal(file.Text, file.Language, formatter, theme)
+		if err != nil {
+			logger.Error().Str("ID", snippet.ID).Err(err).Msg("Error while highlighting snippet for a terminal")
+			return c.String(http.StatusInternalServerError, "Internal server error\n")
+		}
+		out.WriteString(highlighted)
+		if !strings.HasSuffix(file.Text, "\n") {
+			out.WriteString("\n")
+		}
+	}
+
+	res := c.Response()
+	res.Header().Set("X-Content-Type-Options", "nosniff")
+	if snippet.BurnAfterRead {
+		res.Header().Set("Cache-Control", "no-store")
+	}
+	return c.Blob(http.StatusOK, ansiMIME+"; charset=UTF-8", []byte(out.String()))
+}
+
+func (s *Server) HandleGetRawSnippet(c echo.Context) error {
+	return s.serveSnippetText(c, false)
+}
+
+func (s *Server) HandleDownloadSnippet(c echo.Context) error {
+	return s.serveSnippetText(c, true)
+}
+
+// serveSnippetText writes the snippet text as text/plain, or the file named
+// by the name parameter of a multi-file snippet. Downloads of uploaded files
+// keep their original name and MIME type. Snippets that can be read
+// more than once get ETag and Last-Modified validators.
+func (s *Server) serveSnippetText(c echo.Context, attachment bool) error {
+	snippet, status := s.authorizeSnippet(c, c.Param("id"))
+	if status != http.StatusOK {
+		return c.String(status, snippetErrorMessage(c, status)+"\n")
+	}
+	name := c.Param("name")
+	if name != "" && snippet.File(name) == nil {
+		return c.String(http.StatusNotFound, "File not found\n")
+	}
+	if snippet, status = s.burnSnippet(c, snippet); status != http.StatusOK {
+		return c.String(status, snippetErrorMessage(c, status)+"\n")
+	}
+
+	text, language := snippet.Text, snippet.Language
+	filename := snippet.ID + util.LanguageExtension(snippet.Language)
+	contentType := echo.MIMETextPlainCharsetUTF8
+	if file := snippet.File(name); file != nil {
+		text, language, filename = file.Text, file.Language, file.Name
+	} else if snippet.Filename != "" {
+		// Uploads are downloaded as they were sent. Binary files are never
+		// shown as text.
+		filename = snippet.Filename
+		if attachment {
+			contentType = snippet.MimeType
+		} else if snippet.IsBinary() {
+			contentType = echo.MIMEOctetStream
+		}
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, contentType)
+	res.Header().Set("X-Content-Type-Options", "nosniff")
+	if attachment {
+		res.Header().Set(echo.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	}
+
+	if snippet.BurnAfterRead {
+		res.Header().Set("Cache-Control", "no-store")
+		return c.String(http.StatusOK, text)
+	}
+
+	res.Header().Set("ETag", textETag(language, text))
+	res.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(res, c.Request(), "", snippet.UpdatedAt, strings.NewReader(text))
+	return nil
+}
+
+func textETag(language, text string) string {
+	sum := sha256.Sum256([]byte(language + "\x00" + text))
+	return fmt.Sprintf(`"%x"`, sum[:16])
+}
+
 func (s *Server) HandlePostSnippet(c echo.Context) error {
 	logger := util.GetLoggerWithRequestID(c)
 	data := new(PostSnippetReq)
 	contentType := c.Request().Header.Get("Content-Type")
+	// Uploads from the CLI are multipart but still want JSON errors.
+	jsonResponse := strings.HasPrefix(contentType, "application/json") || strings.Contains(c.Request().Header.Get("Accept"), "application/json")
+
+	if strings.HasPrefix(contentType, echo.MIMETextPlain) || strings.HasPrefix(contentType, echo.MIMEOctetStream) {
+		return s.HandlePostSnippetPlain(c)
+	}
+
+	multipart := strings.HasPrefix(contentType, echo.MIMEMultipartForm)
+	if multipart {
+		c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, maxUploadSize()+maxPlainBodyBytes)
+	}
 
 	if err := c.Bind(data); err != nil {
 		logger.Error().Err(err).Msg("Error while binding data")
-		if strings.HasPrefix(contentType, "application/json") {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			message := fmt.Sprintf("File must be at most %d bytes", maxUploadSize())
+			if jsonResponse {
+				return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": message})
+			} else {
+				return Render(c, http.StatusRequestEntityTooLarge, views.ErrorAlert(message))
+			}
+		}
+		if jsonResponse {
 			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
 		} else {
 			return Render(c, http.StatusBadRequest, views.ErrorAlert("Invalid request data"))
 		}
 	}
 
+	// The web form's Encrypt checkbox is replaced by the ciphertext in the
+	// browser. If it arrives as is, the script did not run and the text is
+	// plaintext that the user wanted encrypted.
+	if data.Encrypt && data.Encryption == "" {
+		logger.Warn().Msg("Encrypt requested without ciphertext")
+		message := "The snippet was not encrypted. Encryption needs JavaScript enabled"
+		if jsonResponse {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": message})
+		} else {
+			return Render(c, http.StatusBadRequest, views.ErrorAlert(message))
+		}
+	}
+
+	var upload *snippetUpload
+	if multipart {
+		var status int
+		var err error
+		if upload, status, err = readUpload(c); err == nil && upload != nil && data.Encryption != "" {
+			status, err = http.StatusBadRequest, fmt.Errorf("Encrypted snippets cannot be uploaded as files")
+		}
+		if err != nil {
+			logger.Warn().Err(err).Msg("Invalid upload")
+			if jsonResponse {
+				return c.JSON(status, map[string]string{"error": err.Error()})
+			} else {
+				return Render(c, status, views.ErrorAlert(err.Error()))
+			}
+		}
+	}
+	if upload != nil {
+		data.Text = string(upload.Data)
+		if upload.Binary() {
+			data.Language = "txt"
+		}
+		logger.Debug().Str("filename", upload.Filename).Str("mime_type", upload.MimeType).Int("size", len(upload.Data)).Msg("Received upload")
+	}
+
 	logger.Debug().Interface("data", data).Msg("Creating snippet")
 	if err := c.Validate(data); err != nil {
 		logger.Error().Err(err).Msg("Error while validating data")
-		if strings.HasPrefix(contentType, "application/json") {
+		if jsonResponse {
 			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 		} else {
 			return Render(c, http.StatusBadRequest, views.ErrorAlert("Invalid request data"))
 		}
 	}
 
-	if !storage.IsValidLanguage(data.Language) {
+	if err := validatePassword(data.Password); err != nil {
+		logger.Warn().Err(err).Msg("Invalid password")
+		if jsonResponse {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		} else {
+			return Render(c, http.StatusBadRequest, views.ErrorAlert(err.Error()))
+		}
+	}
+
+	var files []storage.SnippetFile
+	if len(data.Files) > 0 {
+		var err error
+		if files, err = snippetFiles(data); err != nil {
+			logger.Warn().Err(err).Msg("Invalid files")
+			if jsonResponse {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+			} else {
+				return Render(c, http.StatusBadRequest, views.ErrorAlert(err.Error()))
+			}
+		}
+	}
+
+	// Uploads are bounded by MAX_UPLOAD_SIZE instead of the text limit.
+	if upload == nil {
+		if err := validateSnippetText(data.Text, data.Encryption); err != nil {
+			logger.Warn().Str("encryption", data.Encryption).Err(err).Msg("Invalid text")
+			if jsonResponse {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+			} else {
+				return Render(c, http.StatusBadRequest, views.ErrorAlert(err.Error()))
+			}
+		}
+	}
+
+	if data.ForkedFrom != "" && !storage.IsValidID(data.ForkedFrom) {
+		logger.Warn().Str("forked_from", data.ForkedFrom).Msg("Invalid fork parent")
+		if jsonResponse {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid forked_from"})
+		} else {
+			return Render(c, http.StatusBadRequest, views.ErrorAlert("Invalid fork parent"))
+		}
+	}
+
+	if !isValidLanguageOrAuto(data.Language) {
 		logger.Warn().Str("language", data.Language).Msg("Invalid language")
-		if strings.HasPrefix(contentType, "application/json") {
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Invalid language. Options: %v", storage.GetValidLanguages())})
+		if jsonResponse {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid language. See /api/languages for the options"})
 		} else {
 			return Render(c, http.StatusBadRequest, views.ErrorAlert("Invalid language"))
 		}
 	}
 
-	if !storage.IsValidExpiration(data.Expiry) {
-		logger.Warn().Str("expiry", data.Expiry).Msg("Invalid expiry")
-		if strings.HasPrefix(contentType, "application/json") {
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Invalid expiry. Options: %v", storage.GetValidExpirations())})
+	expiryValue := data.Expiry
+	if data.ExpiresAt != "" {
+		expiryValue = data.ExpiresAt
+	}
+	expiry, err := storage.ParseExpiration(expiryValue)
+	if err == nil {
+		err = expiry.Validate()
+	}
+	if err != nil {
+		logger.Warn().Str("expiry", expiryValue).Err(err).Msg("Invalid expiry")
+		if jsonResponse {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("%s. Use a duration (e.g. 30m, 7d, 2w, P1D), an RFC 3339 timestamp or %q", err, storage.ExpirationNever)})
 		} else {
 			return Render(c, http.StatusBadRequest, views.ErrorAlert("Invalid expiry"))
 		}
 	}
 
-	snippet, err := s.store.CreateSnippet(data.Text, data.BurnAfterRead, storage.GetSnippetExpiration(data.Expiry), data.Language)
+	params := storage.CreateSnippetParams{
+		Text:          data.Text,
+		BurnAfterRead: data.BurnAfterRead,
+		Expiry:        expiry,
+		Language:      data.Language,
+		Password:      data.Password,
+		Encryption:    data.Encryption,
+		ForkedFrom:    data.ForkedFrom,
+		Files:         files,
+	}
+	if upload != nil {
+		params.Filename = upload.Filename
+		params.MimeType = upload.MimeType
+	}
+	snippet, err := s.store.CreateSnippetWithParams(params)
 	if err != nil {
 		logger.Error().Err(err).Msg("Error while creating snippet")
-		if strings.HasPrefix(contentType, "application/json") {
+		if jsonResponse {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 		} else {
 			return Render(c, http.StatusInternalServerError, views.ErrorAlert("Failed to create snippet"))
@@ -147,3 +770,459 @@ func (s *Server) HandlePostSnippet(c echo.Context) error {
 		return Render(c, http.StatusCreated, views.PostSnippetResponse(snippet))
 	}
 }
+
+// maxPlainBodyBytes bounds how much of a plain body is read. The character
+// limit of PostSnippetReq is enforced afterwards.
+const maxPlainBodyBytes = 64 << 10
+
+// plainParam reads a snippet option from the query string, falling back to
+// the given header.
+func plainParam(c echo.Context, name, header string) string {
+	if value := c.QueryParam(name); value != "" {
+		return value
+	}
+	return c.Request().Header.Get(header)
+}
+
+// HandlePostSnippetPlain creates a snippet from a raw request body, as sent
+// by `curl --data-binary @-`. Options come from the query string or X-*
+// headers and the response is the snippet URL on a single line.
+func (s *Server) HandlePostSnippetPlain(c echo.Context) error {
+	logger := util.GetLoggerWithRequestID(c)
+
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxPlainBodyBytes+1))
+	if err != nil {
+		logger.Error().Err(err).Msg("Error while reading body")
+		return c.String(http.StatusBadRequest, "Error: Invalid request body\n")
+	}
+	if len(body) > maxPlainBodyBytes {
+		return c.String(http.StatusRequestEntityTooLarge, "Error: Snippet too large\n")
+	}
+
+	data := &PostSnippetReq{
+		Text:       string(body),
+		Language:   plainParam(c, "language", "X-Language"),
+		Expiry:     plainParam(c, "expiry", "X-Expiry"),
+		Password:   c.Request().Header.Get("X-Snippet-Password"),
+		Encryption: plainParam(c, "encryption", "X-Encryption"),
+	}
+	if burn := plainParam(c, "burn", "X-Burn-After-Read"); burn != "" {
+		data.BurnAfterRead, err = strconv.ParseBool(burn)
+		if err != nil {
+			return c.String(http.StatusBadRequest, "Error: Invalid burn value\n")
+		}
+	}
+
+	snippet, status, err := s.createPlainSnippet(data)
+	if err != nil {
+		logger.Error().Err(err).Msg("Error while creating plain snippet")
+		return c.String(status, fmt.Sprintf("Error: %s\n", err))
+	}
+
+	c.Response().Header().Set("X-Snippet-Token", snippet.Token)
+	return c.String(http.StatusCreated, publicURL(c)+"/"+snippet.ID+"\n")
+}
+
+// createPlainSnippet validates and stores a snippet submitted as a raw body,
+// over HTTP or the TCP listener, filling in the configured defaults. Errors
+// are safe to show to the client and come with the status to respond with.
+func (s *Server) createPlainSnippet(data *PostSnippetReq) (*storage.Snippet, int, error) {
+	if data.Language == "" {
+		data.Language = defaultLanguage()
+	}
+	if data.Expiry == "" {
+		data.Expiry = defaultExpiry()
+	}
+
+	if err := s.echo.Validator.Validate(data); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if err := validateSnippetText(data.Text, data.Encryption); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if err := validatePassword(data.Password); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if !isValidLanguageOrAuto(data.Language) {
+		return nil, http.StatusBadRequest, fmt.Errorf("Invalid language. See /api/languages for the options")
+	}
+
+	expiry, err := storage.ParseExpiration(data.Expiry)
+	if err == nil {
+		err = expiry.Validate()
+	}
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	snippet, err := s.store.CreateSnippetWithParams(storage.CreateSnippetParams{
+		Text:          data.Text,
+		BurnAfterRead: data.BurnAfterRead,
+		Expiry:        expiry,
+		Language:      data.Language,
+		Password:      data.Password,
+		Encryption:    data.Encryption,
+	})
+	if err != nil {
+		util.GetLogger().Error().Err(err).Msg("Error while creating snippet")
+		return nil, http.StatusInternalServerError, fmt.Errorf("Failed to create snippet")
+	}
+	return snippet, http.StatusCreated, nil
+}
+
+type PatchSnippetReq struct {
+	Text          *string `form:"text" json:"text" validate:"omitempty,min=1"`
+	BurnAfterRead *bool   `form:"burn_after_read" json:"burn_after_read"`
+	Language      *string `form:"language" json:"language"`
+	Expiry        *string `form:"expiry" json:"expiry"`
+}
+
+// snippetToken extracts the management token from the Authorization or
+// X-Snippet-Token header.
+func snippetToken(c echo.Context) string {
+	if token, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return c.Request().Header.Get("X-Snippet-Token")
+}
+
+// getManagedSnippet loads a live snippet and checks the request carries its
+// management token. It writes the error response itself and returns nil when
+// the request cannot proceed.
+func (s *Server) getManagedSnippet(c echo.Context) (*storage.Snippet, error) {
+	logger := util.GetLoggerWithRequestID(c)
+	id := c.Param("id")
+
+	snippet, err := s.store.GetSnippetByID(id)
+	if err != nil {
+		logger.Error().Str("ID", id).Err(err).Msg("Error while getting snippet")
+		return nil, c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+	}
+	if snippet == nil || snippet.IsExpired() {
+		logger.Warn().Str("ID", id).Msg("Snippet not found")
+		return nil, c.JSON(http.StatusNotFound, map[string]string{"error": "Snippet not found"})
+	}
+	if !snippet.VerifyToken(snippetToken(c)) {
+		logger.Warn().Str("ID", id).Msg("Invalid snippet token")
+		return nil, c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid token"})
+	}
+	return snippet, nil
+}
+
+func (s *Server) HandleDeleteSnippet(c echo.Context) error {
+	logger := util.GetLoggerWithRequestID(c)
+
+	snippet, err := s.getManagedSnippet(c)
+	if snippet == nil {
+		return err
+	}
+
+	if err := s.store.DeleteSnippet(snippet.ID); err != nil {
+		logger.Error().Str("ID", snippet.ID).Err(err).Msg("Error while deleting snippet")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+	}
+
+	logger.Info().Str("ID", snippet.ID).Msg("Deleted snippet")
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (s *Server) HandlePatchSnippet(c echo.Context) error {
+	logger := util.GetLoggerWithRequestID(c)
+
+	snippet, err := s.getManagedSnippet(c)
+	if snippet == nil {
+		return err
+	}
+
+	data := new(PatchSnippetReq)
+	if err := c.Bind(data); err != nil {
+		logger.Error().Err(err).Msg("Error while binding data")
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request data"})
+	}
+	if err := c.Validate(data); err != nil {
+		logger.Error().Err(err).Msg("Error while validating data")
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	updated := *snippet
+	if data.Text != nil && len(snippet.Files) > 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "The text of multi-file snippets cannot be edited"})
+	}
+	if data.Text != nil && snippet.IsBinary() {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "The text of binary uploads cannot be edited"})
+	}
+	if data.Text != nil {
+		// The text of an encrypted snippet must be re-encrypted by the
+		// client with the same key.
+		if err := validateSnippetText(*data.Text, snippet.Encryption); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		updated.Text = *data.Text
+	}
+	if data.BurnAfterRead != nil {
+		updated.BurnAfterRead = *data.BurnAfterRead
+	}
+	if data.Language != nil {
+		if !storage.IsValidLanguage(*data.Language) {
+			logger.Warn().Str("language", *data.Language).Msg("Invalid language")
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid language. See /api/languages for the options"})
+		}
+		updated.Language = *data.Language
+	}
+	if data.Expiry != nil {
+		expiry, err := storage.ParseExpiration(*data.Expiry)
+		if err == nil {
+			err = expiry.Validate()
+		}
+		if err != nil {
+			logger.Warn().Str("expiry", *data.Expiry).Err(err).Msg("Invalid expiry")
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		updated.ExpiresAt = time.Time{}
+		if expiresAt := expiry.GetExpirationTime(); expiresAt != nil {
+			updated.ExpiresAt = *expiresAt
+		}
+	}
+
+	if err := s.store.UpdateSnippet(&updated); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			logger.Warn().Str("ID", snippet.ID).Msg("Snippet deleted while updating it")
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Snippet not found"})
+		}
+		logger.Error().Str("ID", snippet.ID).Err(err).Msg("Error while updating snippet")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+	}
+
+	logger.Info().Str("ID", snippet.ID).Msg("Updated snippet")
+	return c.JSON(http.StatusOK, &updated)
+}
+
+// HandleForkSnippet opens the editor pre-filled with a snippet. Forking
+// reads the snippet, so it burns burn-after-read snippets. The editor holds a
+// single text, so multi-file snippets are refused before they are read.
+func (s *Server) HandleForkSnippet(c echo.Context) error {
+	snippet, status := s.authorizeSnippet(c, c.Param("id"))
+	if status != http.StatusOK {
+		return renderSnippetError(c, status)
+	}
+	if len(snippet.Files) > 0 {
+		message := "Multi-file snippets cannot be forked in the browser. Fork them with the CLI instead"
+		if strings.Contains(c.Request().Header.Get("Accept"), "application/json") {
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": message})
+		}
+		return Render(c, http.StatusUnprocessableEntity, views.MessagePage(message))
+	}
+	if snippet, status = s.burnSnippet(c, snippet); status != http.StatusOK {
+		return renderSnippetError(c, status)
+	}
+	return Render(c, http.StatusOK, views.Index(snippet))
+}
+
+// HandleGetSnippetHistory lists the revisions of a snippet. Reading the
+// history counts as reading a burn-after-read snippet.
+func (s *Server) HandleGetSnippetHistory(c echo.Context) error {
+	logger := util.GetLoggerWithRequestID(c)
+
+	snippet, status := s.authorizeSnippet(c, c.Param("id"))
+	if status != http.StatusOK {
+		return renderSnippetError(c, status)
+	}
+
+	revisions, err := s.store.ListRevisions(snippet)
+	if err != nil {
+		logger.Error().Str("ID", snippet.ID).Err(err).Msg("Error while listing revisions")
+		return renderSnippetError(c, http.StatusInternalServerError)
+	}
+
+	if snippet, status = s.burnSnippet(c, snippet); status != http.StatusOK {
+		return renderSnippetError(c, status)
+	}
+
+	accept := c.Request().Header.Get("Accept")
+	if strings.Contains(accept, "application/json") {
+		return c.JSON(http.StatusOK, map[string]interface{}{"id": snippet.ID, "revisions": revisions})
+	} else {
+		return Render(c, http.StatusOK, views.HistoryPage(snippet, revisions))
+	}
+}
+
+// HandleGetSnippetRevision shows an old revision of a snippet, with the same
+// expiry, password and burn-after-read checks as the snippet itself.
+func (s *Server) HandleGetSnippetRevision(c echo.Context) error {
+	logger := util.GetLoggerWithRequestID(c)
+
+	n, err := strconv.Atoi(c.Param("n"))
+	if err != nil || n < 1 {
+		return renderSnippetError(c, http.StatusNotFound)
+	}
+
+	snippet, status := s.authorizeSnippet(c, c.Param("id"))
+	if status != http.StatusOK {
+		return renderSnippetError(c, status)
+	}
+
+	revision, err := s.store.GetRevision(snippet, n)
+	if err != nil {
+		logger.Error().Str("ID", snippet.ID).Int("revision", n).Err(err).Msg("Error while getting revision")
+		return renderSnippetError(c, http.StatusInternalServerError)
+	}
+	if revision == nil {
+		logger.Warn().Str("ID", snippet.ID).Int("revision", n).Msg("Revision not found")
+		return renderSnippetError(c, http.StatusNotFound)
+	}
+
+	if snippet, status = s.burnSnippet(c, snippet); status != http.StatusOK {
+		return renderSnippetError(c, status)
+	}
+
+	accept := c.Request().Header.Get("Accept")
+	if strings.Contains(accept, "application/json") {
+		return c.JSON(http.StatusOK, revision)
+	} else {
+		return Render(c, http.StatusOK, views.RevisionPage(snippet, revision))
+	}
+}
+
+// diffSide is one side of a diff: a snippet, or one of its revisions when
+// the reference has the form <id>@<revision>.
+type diffSide struct {
+	ref      string
+	snippet  *storage.Snippet
+	text     string
+	language string
+}
+
+// loadDiffSide resolves a diff reference without burning the snippet. On
+// failure it returns the status and message to respond with.
+func (s *Server) loadDiffSide(c echo.Context, ref string) (*diffSide, int, string) {
+	logger := util.GetLoggerWithRequestID(c)
+
+	id, rev, hasRev := strings.Cut(ref, "@")
+	snippet, status := s.authorizeSnippet(c, id)
+	if status != http.StatusOK {
+		return nil, status, snippetErrorMessage(c, status)
+	}
+	if snippet.IsEncrypted() {
+		return nil, http.StatusUnprocessableEntity, "Encrypted snippets can only be diffed by a client holding their keys"
+	}
+	if snippet.IsBinary() {
+		return nil, http.StatusUnprocessableEntity, "Binary files cannot be diffed"
+	}
+	// Revisions only keep the first file, so the files of a multi-file
+	// snippet could not be diffed against its history.
+	if len(snippet.Files) > 0 {
+		return nil, http.StatusUnprocessableEntity, "Multi-file snippets cannot be diffed"
+	}
+
+	side := &diffSide{ref: ref, snippet: snippet, text: snippet.Text, language: snippet.Language}
+	if hasRev {
+		n, err := strconv.Atoi(rev)
+		if err != nil || n < 1 {
+			return nil, http.StatusNotFound, "Revision not found"
+		}
+		revision, err := s.store.GetRevision(snippet, n)
+		if err != nil {
+			logger.Error().Str("ID", id).Int("revision", n).Err(err).Msg("Error while getting revision")
+			return nil, http.StatusInternalServerError, "Internal server error"
+		}
+		if revision == nil {
+			return nil, http.StatusNotFound, "Revision not found"
+		}
+		side.text, side.language = revision.Text, revision.Language
+	}
+	return side, http.StatusOK, ""
+}
+
+func renderDiffError(c echo.Context, raw bool, status int, message string) error {
+	switch {
+	case raw:
+		return c.String(status, message+"\n")
+	case status == http.StatusNotFound, status == http.StatusUnauthorized, status == http.StatusTooManyRequests:
+		return renderSnippetError(c, status)
+	case strings.Contains(c.Request().Header.Get("Accept"), "application/json"):
+		return c.JSON(status, map[string]string{"error": message})
+	case status == http.StatusConflict:
+		return Render(c, status, views.DiffConfirmPage(c.Request().URL.Path))
+	case status == http.StatusInternalServerError:
+		return Render(c, status, views.ErrorPage())
+	default:
+		return Render(c, status, views.MessagePage(message))
+	}
+}
+
+// HandleGetDiff compares two snippets or revisions, referenced as <id> or
+// <id>@<revision>. A .diff suffix on the second reference returns a raw
+// unified diff. Burn-after-read snippets are only diffed, and burned, when
+// the request confirms it with ?confirm=true.
+func (s *Server) HandleGetDiff(c echo.Context) error {
+	logger := util.GetLoggerWithRequestID(c)
+
+	refA := c.Param("a")
+	refB, raw := strings.CutSuffix(c.Param("b"), ".diff")
+	confirmed, _ := strconv.ParseBool(c.FormValue("confirm"))
+
+	a, status, message := s.loadDiffSide(c, refA)
+	if status != http.StatusOK {
+		return renderDiffError(c, raw, status, message)
+	}
+	b, status, message := s.loadDiffSide(c, refB)
+	if status != http.StatusOK {
+		return renderDiffError(c, raw, status, message)
+	}
+
+	if (a.snippet.BurnAfterRead || b.snippet.BurnAfterRead) && !confirmed {
+		logger.Warn().Str("a", refA).Str("b", refB).Msg("Diff of burn-after-read snippet not confirmed")
+		return renderDiffError(c, raw, http.StatusConflict, "Diffing a burn-after-read snippet burns it. Repeat the request with ?confirm=true")
+	}
+
+	lines := util.DiffLines(a.text, b.text)
+
+	burned := map[string]bool{}
+	for _, side := range []*diffSide{a, b} {
+		if !side.snippet.BurnAfterRead || burned[side.snippet.ID] {
+			continue
+		}
+		if _, status := s.burnSnippet(c, side.snippet); status != http.StatusOK {
+			return renderDiffError(c, raw, status, snippetErrorMessage(c, status))
+		}
+		burned[side.snippet.ID] = true
+	}
+
+	if raw {
+		c.Response().Header().Set("X-Content-Type-Options", "nosniff")
+		return c.String(http.StatusOK, util.UnifiedDiff(refA, refB, lines, 3))
+	}
+
+	accept := c.Request().Header.Get("Accept")
+	if strings.Contains(accept, "application/json") {
+		return c.JSON(http.StatusOK, map[string]string{"a": refA, "b": refB, "diff": util.UnifiedDiff(refA, refB, lines, 3)})
+	}
+
+	oldHTML, err := util.HighlightLines(a.text, a.language)
+	var newHTML []string
+	if err == nil {
+		newHTML, err = util.HighlightLines(b.text, b.language)
+	}
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to highlight diff")
+	}
+	for i := range lines {
+		switch {
+		case err != nil:
+			lines[i].HTML = template.HTMLEscapeString(lines[i].Text)
+		case lines[i].Kind == util.DiffInsert:
+			lines[i].HTML = newHTML[lines[i].NewNumber-1]
+		default:
+			lines[i].HTML = oldHTML[lines[i].OldNumber-1]
+		}
+	}
+
+	view := c.QueryParam("view")
+	if view != "unified" {
+		view = "split"
+	}
+	return Render(c, http.StatusOK, views.DiffPage(refA, refB, lines, view))
+}
@@ -0,0 +1,897 @@
+package server
+
+import (
+	"binp/storage"
+	"binp/util"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupTestServer(t *testing.T) (Server, *storage.Store) {
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "db.sqlite"))
+	db, err := storage.NewDB()
+	assert.NoError(t, err)
+
+	store := storage.NewStoreWithRepository(db)
+	assert.NoError(t, store.Init())
+	t.Cleanup(func() { store.Close() })
+
+	return NewServer(store), store
+}
+
+func TestBurnAfterReadIsServedOnce(t *testing.T) {
+	serv, store := setupTestServer(t)
+
+	snippet, err := store.CreateSnippet("burn me", true, storage.OneHour, "txt")
+	assert.NoError(t, err)
+
+	const readers = 50
+	var wg sync.WaitGroup
+	statuses := make(chan int, readers)
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodGet, "/"+snippet.ID, nil)
+			req.Header.Set("Accept", "application/json")
+			req.RemoteAddr = fmt.Sprintf("10.0.0.%d:1234", i)
+			rec := httptest.NewRecorder()
+			serv.echo.ServeHTTP(rec, req)
+			statuses <- rec.Code
+		}(i)
+	}
+	wg.Wait()
+	close(statuses)
+
+	counts := make(map[int]int)
+	for status := range statuses {
+		counts[status]++
+	}
+	assert.Equal(t, 1, counts[http.StatusOK])
+	assert.Equal(t, readers-1, counts[http.StatusNotFound])
+}
+
+func TestManageSnippetWithToken(t *testing.T) {
+	serv, store := setupTestServer(t)
+
+	snippet, err := store.CreateSnippet("fmt.Println()", false, storage.OneHour, "txt")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, snippet.Token)
+
+	cached, err := store.GetSnippetByID(snippet.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, cached.Token)
+
+	do := func(method, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/"+snippet.ID, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		serv.echo.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodPatch, "", `{"language":"go"}`).Code)
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodDelete, "wrong", "").Code)
+
+	rec := do(http.MethodPatch, snippet.Token, `{"language":"go","text":"package main"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), snippet.Token)
+
+	updated, err := store.GetSnippetByID(snippet.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "go", updated.Language)
+	assert.Equal(t, "package main", updated.Text)
+
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, snippet.Token, "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, snippet.Token, "").Code)
+}
+
+func TestRawAndDownloadSnippet(t *testing.T) {
+	serv, store := setupTestServer(t)
+
+	snippet, err := store.CreateSnippet("fn main() {}", false, storage.OneHour, "rust")
+	assert.NoError(t, err)
+
+	get := func(path string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		serv.echo.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/raw/"+snippet.ID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "fn main() {}", rec.Body.String())
+	assert.Equal(t, "text/plain; charset=UTF-8", rec.Header().Get("Content-Type"))
+	etag := rec.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	assert.NotEmpty(t, rec.Header().Get("Last-Modified"))
+
+	rec = get("/raw/"+snippet.ID, map[string]string{"If-None-Match": etag})
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+
+	rec = get("/dl/"+snippet.ID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "attachment; filename="+snippet.ID+".rs", rec.Header().Get("Content-Disposition"))
+
+	burn, err := store.CreateSnippet("once", true, storage.OneHour, "txt")
+	assert.NoError(t, err)
+
+	rec = get("/raw/"+burn.ID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "once", rec.Body.String())
+	assert.Empty(t, rec.Header().Get("ETag"))
+	assert.Equal(t, http.StatusNotFound, get("/dl/"+burn.ID, nil).Code)
+}
+
+func TestPostSnippetPlain(t *testing.T) {
+	serv, store := setupTestServer(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/?language=go&expiry=1h", strings.NewReader("package main\n"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	serv.echo.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("X-Snippet-Token"))
+
+	url := strings.TrimSpace(rec.Body.String())
+	assert.True(t, strings.HasPrefix(url, "http://example.com/"))
+	snippet, err := store.GetSnippetByID(strings.TrimPrefix(url, "http://example.com/"))
+	assert.NoError(t, err)
+	assert.Equal(t, "package main\n", snippet.Text)
+	assert.Equal(t, "go", snippet.Language)
+
+	req = httptest.NewRequest(http.MethodPost, "/snippet", strings.NewReader("secret"))
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("X-Burn-After-Read", "true")
+	rec = httptest.NewRecorder()
+	serv.echo.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	snippet, err = store.GetSnippetByID(strings.TrimPrefix(strings.TrimSpace(rec.Body.String()), "http://example.com/"))
+	assert.NoError(t, err)
+	assert.True(t, snippet.BurnAfterRead)
+	assert.Equal(t, "txt", snippet.Language)
+
+	t.Setenv("BINP_BASE_URL", "https://binp.test")
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("behind a proxy"))
+	rec = httptest.NewRecorder()
+	serv.echo.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.True(t, strings.HasPrefix(rec.Body.String(), "https://binp.test/"), rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodPost, "/?language=klingon", strings.NewReader("qapla'"))
+	rec = httptest.NewRecorder()
+	serv.echo.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestPasswordProtectedSnippet(t *testing.T) {
+	serv, store := setupTestServer(t)
+
+	snippet, err := store.CreateSnippetWithParams(storage.CreateSnippetParams{
+		Text:          "top secret",
+		BurnAfterRead: true,
+		Expiry:        storage.OneHour,
+		Language:      "txt",
+		Password:      "hunter2",
+	})
+	assert.NoError(t, err)
+
+	get := func(id, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/"+id, nil)
+		req.Header.Set("Accept", "application/json")
+		if password != "" {
+			req.Header.Set("X-Snippet-Password", password)
+		}
+		rec := httptest.NewRecorder()
+		serv.echo.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, get(snippet.ID, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, get(snippet.ID, "wrong").Code)
+
+	rec := get(snippet.ID, "hunter2")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "top secret")
+	assert.Equal(t, http.StatusNotFound, get(snippet.ID, "hunter2").Code)
+
+	locked, err := store.CreateSnippetWithParams(storage.CreateSnippetParams{
+		Text:     "locked",
+		Expiry:   storage.OneHour,
+		Language: "txt",
+		Password: "correct horse",
+	})
+	assert.NoError(t, err)
+	for i := 0; i < passwordAttemptBurst; i++ {
+		assert.Equal(t, http.StatusUnauthorized, get(locked.ID, "guess").Code)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, get(locked.ID, "correct horse").Code)
+
+	// bcrypt's limit is 72 bytes, which 30 CJK characters exceed.
+	long := strings.Repeat("密", 30)
+	req := httptest.NewRequest(http.MethodPost, "/snippet", strings.NewReader(`{"text":"x","expiry":"1h","password":"`+long+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	serv.echo.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("x"))
+	req.Header.Set("X-Snippet-Password", long)
+	rec = httptest.NewRecorder()
+	serv.echo.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestEncryptedSnippet(t *testing.T) {
+	serv, store := setupTestServer(t)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/snippet", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		rec := httptest.NewRecorder()
+		serv.echo.ServeHTTP(rec, req)
+		return rec
+	}
+
+	ciphertext := base64.StdEncoding.EncodeToString(make([]byte, 48))
+	rec := post(`{"text":"` + ciphertext + `","language":"go","expiry":"1h","encryption":"aes-256-gcm"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	var created storage.Snippet
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	snippet, err := store.GetSnippetByID(created.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, ciphertext, snippet.Text)
+	assert.Equal(t, storage.EncryptionAES256GCM, snippet.Encryption)
+	assert.Empty(t, snippet.HighlightedCode)
+
+	req := httptest.NewRequest(http.MethodGet, "/"+created.ID, nil)
+	rec = httptest.NewRecorder()
+	serv.echo.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `data-ciphertext="`+ciphertext+`"`)
+
+	rec = post(`{"text":"not ciphertext","language":"go","expiry":"1h","encryption":"aes-256-gcm"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = post(`{"text":"` + ciphertext + `","language":"go","expiry":"1h","encryption":"rot13"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// A form posted with Encrypt ticked but without ciphertext means the
+	// browser did not encrypt it, so the plaintext must not be stored.
+	form := url.Values{"text": {"plaintext"}, "language": {"txt"}, "expiry": {"1h"}, "encrypt": {"true"}}
+	req = httptest.NewRequest(http.MethodPost, "/snippet", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", echo.MIMEApplicationForm)
+	rec = httptest.NewRecorder()
+	serv.echo.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "The snippet was not encrypted")
+}
+
+func TestScriptIsServed(t *testing.T) {
+	// Static files are served relative to the repository root.
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(".."))
+	t.Cleanup(func() { os.Chdir(wd) })
+	serv, _ := setupTestServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	serv.echo.ServeHTTP(rec, req)
+	assert.Contains(t, rec.Body.String(), `<script src="/js/binp.js" defer></script>`)
+	assert.NotContains(t, rec.Body.String(), "highlightjs")
+
+	req = httptest.NewRequest(http.MethodGet, "/js/binp.js", nil)
+	rec = httptest.NewRecorder()
+	serv.echo.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "javascript")
+	assert.Contains(t, rec.Body.String(), "window.binp =")
+}
+
+func TestSnippetHistory(t *testing.T) {
+	serv, store := setupTestServer(t)
+
+	snippet, err := store.CreateSnippet("v1", false, storage.OneHour, "txt")
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPatch, "/"+snippet.ID, strings.NewReader(`{"text":"v2"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Snippet-Token", snippet.Token)
+	rec := httptest.NewRecorder()
+	serv.echo.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept", "application/json")
+		rec := httptest.NewRecorder()
+		serv.echo.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec = get("/" + snippet.ID + "/history")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var history struct {
+		Revisions []storage.Revision `json:"revisions"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &history))
+	assert.Len(t, history.Revisions, 2)
+	assert.Equal(t, storage.HashToken(snippet.Token)[:8], history.Revisions[1].Editor)
+
+	rec = get("/" + snippet.ID + "/rev/1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var revision storage.Revision
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &revision))
+	assert.Equal(t, "v1", revision.Text)
+
+	assert.Equal(t, http.StatusNotFound, get("/"+snippet.ID+"/rev/3").Code)
+	assert.Equal(t, http.StatusNotFound, get("/"+snippet.ID+"/rev/x").Code)
+
+	burn, err := store.CreateSnippet("secret", true, storage.OneHour, "txt")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, get("/"+burn.ID+"/rev/1").Code)
+	assert.Equal(t, http.StatusNotFound, get("/"+burn.ID).Code)
+}
+
+func TestDiffSnippets(t *testing.T) {
+	serv, store := setupTestServer(t)
+
+	a, err := store.CreateSnippet("one\ntwo\nthree\n", false, storage.OneHour, "txt")
+	assert.NoError(t, err)
+	b, err := store.CreateSnippet("one\n2\nthree\n", false, storage.OneHour, "txt")
+	assert.NoError(t, err)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		rec := httptest.NewRecorder()
+		serv.echo.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/diff/" + a.ID + "/" + b.ID + ".diff")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, fmt.Sprintf("--- %s\n+++ %s\n@@ -1,3 +1,3 @@\n one\n-two\n+2\n three\n", a.ID, b.ID), rec.Body.String())
+
+	rec = get("/diff/" + a.ID + "/" + b.ID)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "bg-red-900/40")
+
+	req := httptest.NewRequest(http.MethodPatch, "/"+a.ID, strings.NewReader(`{"text":"one\ntwo\nthree\nfour\n"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Snippet-Token", a.Token)
+	serv.echo.ServeHTTP(httptest.NewRecorder(), req)
+
+	rec = get("/diff/" + a.ID + "@1/" + a.ID + "@2.diff")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "+four\n")
+	assert.Equal(t, http.StatusNotFound, get("/diff/"+a.ID+"@1/"+a.ID+"@9.diff").Code)
+
+	burn, err := store.CreateSnippet("secret\n", true, storage.OneHour, "txt")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, get("/diff/"+a.ID+"/"+burn.ID+".diff").Code)
+	assert.Equal(t, http.StatusOK, get("/diff/"+a.ID+"/"+burn.ID+".diff?confirm=true").Code)
+	assert.Equal(t, http.StatusNotFound, get("/diff/"+a.ID+"/"+burn.ID+".diff?confirm=true").Code)
+
+	binary, err := store.CreateSnippetWithParams(storage.CreateSnippetParams{
+		Text:     "\x89PNG",
+		Expiry:   storage.OneHour,
+		Language: "txt",
+		Filename: "image.png",
+		MimeType: "image/png",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnprocessableEntity, get("/diff/"+a.ID+"/"+binary.ID+".diff").Code)
+
+	files, err := store.CreateSnippetWithParams(storage.CreateSnippetParams{
+		Expiry: storage.OneHour,
+		Files: []storage.SnippetFile{
+			{Name: "main.go", Text: "package main\n"},
+			{Name: "run.sh", Text: "echo hi\n"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnprocessableEntity, get("/diff/"+files.ID+"/"+a.ID+".diff").Code)
+}
+
+func TestForkSnippet(t *testing.T) {
+	serv, store := setupTestServer(t)
+
+	parent, err := store.CreateSnippet("package main", false, storage.OneHour, "go")
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/"+parent.ID+"/fork", nil)
+	rec := httptest.NewRecorder()
+	serv.echo.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "package main</textarea>")
+	assert.Contains(t, rec.Body.String(), `name="forked_from" value="`+parent.ID+`"`)
+	assert.Contains(t, rec.Body.String(), `spellcheck="false" value="go"`)
+
+	req = httptest.NewRequest(http.MethodPost, "/snippet", strings.NewReader(`{"text":"package fork","language":"go","expiry":"1h","forked_from":"`+parent.ID+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	rec = httptest.NewRecorder()
+	serv.echo.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	var fork storage.Snippet
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &fork))
+	assert.Equal(t, parent.ID, fork.ForkedFrom)
+
+	req = httptest.NewRequest(http.MethodGet, "/"+fork.ID, nil)
+	rec = httptest.NewRecorder()
+	serv.echo.ServeHTTP(rec, req)
+	assert.Contains(t, rec.Body.String(), `href="/`+parent.ID+`"`)
+
+	files, err := store.CreateSnippetWithParams(storage.CreateSnippetParams{
+		BurnAfterRead: true,
+		Expiry:        storage.OneHour,
+		Files: []storage.SnippetFile{
+			{Name: "main.go", Text: "package main\n"},
+			{Name: "run.sh", Text: "echo hi\n"},
+		},
+	})
+	assert.NoError(t, err)
+	req = httptest.NewRequest(http.MethodGet, "/"+files.ID+"/fork", nil)
+	rec = httptest.NewRecorder()
+	serv.echo.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "package main")
+
+	// The refused fork did not burn the snippet.
+	burned, err := store.GetSnippetByID(files.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, burned)
+}
+
+func TestMultiFileSnippet(t *testing.T) {
+	serv, _ := setupTestServer(t)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/snippet", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		rec := httptest.NewRecorder()
+		serv.echo.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post(`{"expiry":"1h","files":[{"name":"main.go","text":"package main"},{"name":"app config.yaml","text":"a: 1"}]}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var snippet storage.Snippet
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &snippet))
+	assert.Equal(t, "go", snippet.Language)
+	assert.Equal(t, "package main", snippet.Text)
+	assert.Len(t, snippet.Files, 2)
+	assert.Equal(t, "yaml", snippet.Files[1].Language)
+
+	req := httptest.NewRequest(http.MethodGet, "/raw/"+snippet.ID+"/app%20config.yaml", nil)
+	rec = httptest.NewRecorder()
+	serv.echo.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "a: 1", rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/dl/"+snippet.ID+"/main.go", nil)
+	rec = httptest.NewRecorder()
+	serv.echo.ServeHTTP(rec, req)
+	assert.Equal(t, "attachment; filename=main.go", rec.Header().Get(echo.HeaderContentDisposition))
+
+	req = httptest.NewRequest(http.MethodGet, "/dl/"+snippet.ID+"/app%20config.yaml", nil)
+	rec = httptest.NewRecorder()
+	serv.echo.ServeHTTP(rec, req)
+	assert.Equal(t, `attachment; filename="app config.yaml"`, rec.Header().Get(echo.HeaderContentDisposition))
+
+	req = httptest.NewRequest(http.MethodGet, "/raw/"+snippet.ID+"/missing.txt", nil)
+	rec = httptest.NewRecorder()
+	serv.echo.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/"+snippet.ID, nil)
+	rec = httptest.NewRecorder()
+	serv.echo.ServeHTTP(rec, req)
+	assert.Contains(t, rec.Body.String(), `id="file-main.go"`)
+
+	assert.Equal(t, http.StatusBadRequest, post(`{"expiry":"1h","files":[{"name":"../x","text":"a"}]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, post(`{"expiry":"1h","files":[{"name":"a.txt","text":"a"},{"name":"a.txt","text":"b"}]}`).Code)
+}
+
+func TestUploadSnippet(t *testing.T) {
+	serv, _ := setupTestServer(t)
+
+	upload := func(filename string, data []byte, fields map[string]string) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		for name, value := range fields {
+			writer.WriteField(name, value)
+		}
+		part, _ := writer.CreateFormFile("file", filename)
+		part.Write(data)
+		writer.Close()
+		req := httptest.NewRequest(http.MethodPost, "/snippet", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set("Accept", "application/json")
+		rec := httptest.NewRecorder()
+		serv.echo.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := upload("main.go", []byte("package main\n"), map[string]string{"expiry": "1h"})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var snippet storage.Snippet
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &snippet))
+	assert.Equal(t, "go", snippet.Language)
+	assert.Equal(t, "main.go", snippet.Filename)
+	assert.Equal(t, "package main\n", snippet.Text)
+
+	req := httptest.NewRequest(http.MethodGet, "/dl/"+snippet.ID, nil)
+	rec = httptest.NewRecorder()
+	serv.echo.ServeHTTP(rec, req)
+	assert.Equal(t, "attachment; filename=main.go", rec.Header().Get(echo.HeaderContentDisposition))
+	assert.Equal(t, "package main\n", rec.Body.String())
+
+	rec = upload("script", []byte("#!/bin/bash\necho hi\n"), map[string]string{"expiry": "1h"})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &snippet))
+	assert.Equal(t, "bash", snippet.Language)
+
+	rec = upload("notes.go", []byte("not go"), map[string]string{"expiry": "1h", "language": "txt"})
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &snippet))
+	assert.Equal(t, "txt", snippet.Language)
+
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\xff\xfe")
+	assert.Equal(t, http.StatusUnsupportedMediaType, upload("image.png", png, map[string]string{"expiry": "1h"}).Code)
+
+	t.Setenv("ALLOW_BINARY_UPLOADS", "true")
+	rec = upload("image.png", png, map[string]string{"expiry": "1h"})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &snippet))
+	assert.Equal(t, "image/png", snippet.MimeType)
+	assert.Empty(t, snippet.Text)
+
+	req = httptest.NewRequest(http.MethodGet, "/dl/"+snippet.ID, nil)
+	rec = httptest.NewRecorder()
+	serv.echo.ServeHTTP(rec, req)
+	assert.Equal(t, "image/png", rec.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, png, rec.Body.Bytes())
+
+	req = httptest.NewRequest(http.MethodGet, "/raw/"+snippet.ID, nil)
+	rec = httptest.NewRecorder()
+	serv.echo.ServeHTTP(rec, req)
+	assert.Equal(t, echo.MIMEOctetStream, rec.Header().Get(echo.HeaderContentType))
+
+	req = httptest.NewRequest(http.MethodGet, "/"+snippet.ID, nil)
+	rec = httptest.NewRecorder()
+	serv.echo.ServeHTTP(rec, req)
+	assert.Contains(t, rec.Body.String(), "Binary file, not shown.")
+
+	t.Setenv("MAX_UPLOAD_SIZE", "8")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, upload("big.txt", []byte("0123456789"), map[string]string{"expiry": "1h"}).Code)
+	assert.Equal(t, http.StatusBadRequest, upload("a.txt", []byte("a"), map[string]string{"expiry": "1h", "encryption": storage.EncryptionAES256GCM}).Code)
+}
+
+func TestAutoDetectLanguage(t *testing.T) {
+	serv, _ := setupTestServer(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/snippet", strings.NewReader(`{"text":"#!/bin/bash\necho hi\n","expiry":"1h"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	rec := httptest.NewRecorder()
+	serv.echo.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var snippet storage.Snippet
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &snippet))
+	assert.Equal(t, "bash", snippet.Language)
+	assert.Equal(t, "bash", snippet.DetectedLanguage)
+	assert.Greater(t, snippet.LanguageConfidence, 0.0)
+
+	req = httptest.NewRequest(http.MethodGet, "/"+snippet.ID, nil)
+	rec = httptest.NewRecorder()
+	serv.echo.ServeHTTP(rec, req)
+	assert.Contains(t, rec.Body.String(), "detected: Bash")
+
+	req = httptest.NewRequest(http.MethodGet, "/"+snippet.ID+"?language=python", nil)
+	req.Header.Set("Accept", "application/json")
+	rec = httptest.NewRecorder()
+	serv.echo.ServeHTTP(rec, req)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &snippet))
+	assert.Equal(t, "python", snippet.Language)
+	assert.Equal(t, "bash", snippet.DetectedLanguage)
+}
+
+func TestGetLanguages(t *testing.T) {
+	serv, _ := setupTestServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/languages", nil)
+	rec := httptest.NewRecorder()
+	serv.echo.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var languages []storage.Language
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &languages))
+	assert.Greater(t, len(languages), len(storage.PopularLanguages))
+
+	req = httptest.NewRequest(http.MethodPost, "/snippet", strings.NewReader(`{"text":"a: 1","language":"yml","expiry":"1h"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	rec = httptest.NewRecorder()
+	serv.echo.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var snippet storage.Snippet
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &snippet))
+	assert.Equal(t, "yaml", snippet.Language)
+
+	req = httptest.NewRequest(http.MethodPost, "/snippet", strings.NewReader(`{"text":"a","language":"nope","expiry":"1h"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	serv.echo.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestThemes(t *testing.T) {
+	serv, _ := setupTestServer(t)
+
+	get := func(target string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		serv.echo.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `data-theme="auto"`)
+	assert.Contains(t, rec.Body.String(), `class="dark `)
+
+	rec = get("/?theme=github", &http.Cookie{Name: themeCookie, Value: "dracula"})
+	assert.Contains(t, rec.Body.String(), `data-theme="github"`)
+	assert.Contains(t, rec.Body.String(), `href="/themes/github.css"`)
+	assert.NotContains(t, rec.Body.String(), `class="dark `)
+
+	rec = get("/?theme=nope", &http.Cookie{Name: themeCookie, Value: "dracula"})
+	assert.Contains(t, rec.Body.String(), `data-theme="dracula"`)
+
+	t.Setenv("DEFAULT_THEME", "tokyonight-day")
+	rec = get("/", nil)
+	assert.Contains(t, rec.Body.String(), `data-theme="tokyonight-day"`)
+	assert.NotContains(t, rec.Body.String(), "/themes/")
+
+	rec = get("/themes/github.css", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, strings.HasPrefix(rec.Header().Get(echo.HeaderContentType), "text/css"))
+	assert.Contains(t, rec.Body.String(), `[data-theme="github"] .chroma { color: #000000; background-color: #ffffff; }`)
+
+	assert.Equal(t, http.StatusNotFound, get("/themes/nope.css", nil).Code)
+	assert.Equal(t, http.StatusNotFound, get("/themes/auto.css", nil).Code)
+}
+
+func TestLineNumbers(t *testing.T) {
+	serv, store := setupTestServer(t)
+
+	snippet, err := store.CreateSnippet("a\nb\nc\nd\n", false, storage.OneHour, "txt")
+	assert.NoError(t, err)
+
+	get := func(target string) string {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rec := httptest.NewRecorder()
+		serv.echo.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		return rec.Body.String()
+	}
+
+	body := get("/" + snippet.ID)
+	assert.Contains(t, body, `id="L1"`)
+	assert.Contains(t, body, `href="#L4"`)
+	assert.NotContains(t, body, `class="line hl"`)
+
+	body = get("/" + snippet.ID + "?hl=2-3")
+	assert.Equal(t, 2, strings.Count(body, `class="line hl"`))
+	assert.Contains(t, body, `<span class="line hl"><span class="ln" id="L2">`)
+
+	body = get("/" + snippet.ID + "?hl=L4,nope")
+	assert.Equal(t, 1, strings.Count(body, `class="line hl"`))
+
+	files, err := store.CreateSnippetWithParams(storage.CreateSnippetParams{
+		Expiry: storage.OneHour,
+		Files: []storage.SnippetFile{
+			{Name: "main.go", Text: "package main\n"},
+			{Name: "run.sh", Text: "echo hi\n"},
+		},
+	})
+	assert.NoError(t, err)
+	body = get("/" + files.ID)
+	assert.Contains(t, body, `id="file-main.go-L1"`)
+	assert.Contains(t, body, `id="file-run.sh-L1"`)
+}
+
+func TestRenderedDocuments(t *testing.T) {
+	serv, store := setupTestServer(t)
+
+	get := func(target string) string {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rec := httptest.NewRecorder()
+		serv.echo.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		return rec.Body.String()
+	}
+
+	text := "# Runbook\n\n## snippet source\n\n- [x] deploy\n\n```go\nfunc main() {}\n```\n\n<script>alert(1)</script>\n[click](javascript:alert(1)) <img src=x onerror=alert(1)>\n"
+	snippet, err := store.CreateSnippet(text, false, storage.OneHour, "markdown")
+	assert.NoError(t, err)
+
+	body := get("/" + snippet.ID)
+	start := strings.Index(body, `id="snippet-rendered"`)
+	end := strings.Index(body, `id="snippet-source"`)
+	if assert.True(t, start >= 0 && end > start) {
+		rendered := body[start:end]
+		assert.Contains(t, rendered, `<h1 id="user-content-runbook">Runbook</h1>`)
+		assert.Contains(t, rendered, `<h2 id="user-content-snippet-source">snippet source</h2>`)
+		assert.Contains(t, rendered, `type="checkbox"`)
+		assert.Contains(t, rendered, `<span class="kd">func</span>`)
+		assert.NotContains(t, rendered, "alert")
+		assert.NotContains(t, rendered, "onerror")
+		assert.NotContains(t, rendered, `id="L1"`)
+		assert.Contains(t, body[end:], `id="L1"`)
+	}
+
+	assert.NotContains(t, get("/"+snippet.ID+"?hl=1"), `id="snippet-rendered"`)
+	assert.NotContains(t, get("/"+snippet.ID+"?language=txt"), `id="snippet-rendered"`)
+	assert.Equal(t, text, get("/raw/"+snippet.ID))
+
+	notebook := `{"nbformat": 4, "nbformat_minor": 5, "metadata": {"language_info": {"name": "python"}}, "cells": [
+		{"cell_type": "markdown", "source": ["# Analysis\n", "Some notes"]},
+		{"cell_type": "code", "source": "print(1)", "outputs": [{"output_type": "stream", "name": "stdout", "text": ["1\n"]}]}
+	]}`
+	nb, err := store.CreateSnippet(notebook, false, storage.OneHour, "json")
+	assert.NoError(t, err)
+	body = get("/" + nb.ID)
+	assert.Contains(t, body, `<h1 id="user-content-analysis">Analysis</h1>`)
+	assert.Contains(t, body, `<span class="nb">print</span>`)
+	assert.Contains(t, body, `<pre class="notebook-output">1`)
+
+	plain, err := store.CreateSnippet(`{"a": 1}`, false, storage.OneHour, "json")
+	assert.NoError(t, err)
+	assert.NotContains(t, get("/"+plain.ID), `id="snippet-rendered"`)
+}
+
+func TestANSISnippet(t *testing.T) {
+	serv, store := setupTestServer(t)
+
+	snippet, err := store.CreateSnippet("package main\n", false, storage.OneHour, "go")
+	assert.NoError(t, err)
+
+	get := func(target string, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rec := httptest.NewRecorder()
+		serv.echo.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/"+snippet.ID, "text/x-ansi")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/x-ansi; charset=UTF-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), "\x1b[38;5;")
+	assert.Contains(t, rec.Body.String(), "package")
+	assert.NotContains(t, rec.Body.String(), "<html")
+
+	rec = get("/"+snippet.ID+"?format=ansi&colors=truecolor", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "\x1b[38;2;")
+
+	rec = get("/"+snippet.ID+"?format=ansi&colors=lots", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = get("/nope?format=ansi", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "Snippet not found\n", rec.Body.String())
+
+	files, err := store.CreateSnippetWithParams(storage.CreateSnippetParams{
+		Expiry: storage.OneHour,
+		Files: []storage.SnippetFile{
+			{Name: "main.go", Text: "package main\n"},
+			{Name: "run.sh", Text: "echo hi\n"},
+		},
+	})
+	assert.NoError(t, err)
+	rec = get("/"+files.ID+"?format=ansi", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "==> main.go <==")
+	assert.Contains(t, rec.Body.String(), "==> run.sh <==")
+
+	encrypted, err := store.CreateSnippetWithParams(storage.CreateSnippetParams{
+		Text:       "c2VjcmV0",
+		Language:   "txt",
+		Expiry:     storage.OneHour,
+		Encryption: storage.EncryptionAES256GCM,
+	})
+	assert.NoError(t, err)
+	rec = get("/"+encrypted.ID, "text/x-ansi")
+	assert.Equal(t, http.StatusNotAcceptable, rec.Code)
+}
+
+func TestSnippetImages(t *testing.T) {
+	serv, store := setupTestServer(t)
+
+	snippet, err := store.CreateSnippet("package main\n\nfunc main() {}\n", false, storage.OneHour, "go")
+	assert.NoError(t, err)
+
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rec := httptest.NewRecorder()
+		serv.echo.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/" + snippet.ID + ".svg")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "image/svg+xml", rec.Header().Get("Content-Type"))
+	assert.True(t, strings.HasPrefix(rec.Body.String(), `<svg xmlns="http://www.w3.org/2000/svg"`))
+	assert.Contains(t, rec.Body.String(), "package</tspan>")
+	assert.Contains(t, rec.Body.String(), "translate(32 32) scale(1)")
+
+	rec = get("/" + snippet.ID + ".svg?font_size=28&padding=0&line_numbers=false&theme=github")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "translate(0 0) scale(2)")
+	assert.Contains(t, rec.Body.String(), `fill="#ffffff"`)
+	assert.NotContains(t, rec.Body.String(), "1&#160;&#160;")
+
+	rec = get("/" + snippet.ID + ".png")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "image/png", rec.Header().Get("Content-Type"))
+	img, err := png.Decode(rec.Body)
+	if assert.NoError(t, err) {
+		assert.Greater(t, img.Bounds().Dx(), 64)
+	}
+
+	rec = get("/" + snippet.ID + "/og.png")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	img, err = png.Decode(rec.Body)
+	if assert.NoError(t, err) {
+		assert.Equal(t, image.Rect(0, 0, util.PreviewWidth, util.PreviewHeight), img.Bounds())
+	}
+
+	assert.Equal(t, http.StatusBadRequest, get("/"+snippet.ID+".png?font_size=500").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/"+snippet.ID+".png?line_numbers=maybe").Code)
+	assert.Equal(t, http.StatusNotFound, get("/nope.svg").Code)
+
+	body := get("/" + snippet.ID).Body.String()
+	assert.Contains(t, body, `<meta property="og:image" content="http://example.com/`+snippet.ID+`/og.png">`)
+
+	burn, err := store.CreateSnippet("secret", true, storage.OneHour, "txt")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, get("/"+burn.ID+"/og.png").Code)
+	body = get("/" + burn.ID).Body.String()
+	assert.NotContains(t, body, "og:image")
+}
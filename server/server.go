@@ -3,6 +3,7 @@ package server
 import (
 	"binp/storage"
 	"binp/util"
+	"binp/views"
 	"fmt"
 	"os"
 	"strings"
@@ -15,9 +16,11 @@ import (
 )
 
 type Server struct {
-	store *storage.Store
-	echo  *echo.Echo
-	log   *zerolog.Logger
+	store    *storage.Store
+	echo     *echo.Echo
+	log      *zerolog.Logger
+	limiter  middleware.RateLimiterStore
+	attempts *attemptLimiter
 }
 
 type CustomValidator struct {
@@ -34,6 +37,29 @@ func setCorrectMIMETypeMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	}
 }
 
+// themeCookie remembers the theme picked in the web UI.
+const themeCookie = "theme"
+
+// themeMiddleware chooses the syntax theme pages are rendered with: the theme
+// query parameter, then the theme cookie, then DEFAULT_THEME.
+func themeMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		theme := c.QueryParam("theme")
+		if !util.IsValidTheme(theme) {
+			theme = ""
+			if cookie, err := c.Cookie(themeCookie); err == nil && util.IsValidTheme(cookie.Value) {
+				theme = cookie.Value
+			}
+		}
+		if theme == "" {
+			theme = defaultTheme()
+		}
+		req := c.Request()
+		c.SetRequest(req.WithContext(views.WithTheme(req.Context(), theme)))
+		return next(c)
+	}
+}
+
 func NewServer(s *storage.Store) Server {
 	util.InitLogger()
 	e := echo.New()
@@ -44,7 +70,8 @@ func NewServer(s *storage.Store) Server {
 	e.Use(util.CustomLoggerMiddleware())
 	e.Use(middleware.Recover())
 	e.Use(middleware.Gzip())
-	e.Use(middleware.RateLimiter(middleware.NewRateLimiterMemoryStore(20)))
+	limiter := middleware.NewRateLimiterMemoryStore(20)
+	e.Use(middleware.RateLimiter(limiter))
 
 	allowedOrigins := []string{fmt.Sprintf("http://localhost:%s", os.Getenv("PORT"))}
 	if env == "production" {
@@ -52,27 +79,51 @@ func NewServer(s *storage.Store) Server {
 	}
 
 	corsConfig := middleware.CORSConfig{
-		AllowOrigins: allowedOrigins,
-		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept},
-		AllowMethods: []string{echo.GET, echo.POST},
-		MaxAge:       300,
+		AllowOrigins:  allowedOrigins,
+		AllowHeaders:  []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, "X-Snippet-Token", "X-Snippet-Password", "X-Language", "X-Expiry", "X-Burn-After-Read", "X-Encryption"},
+		ExposeHeaders: []string{"X-Snippet-Token"},
+		AllowMethods:  []string{echo.GET, echo.POST, echo.PATCH, echo.DELETE},
+		MaxAge:        300,
 	}
 
 	e.Use(middleware.CORSWithConfig(corsConfig))
 	e.Use(middleware.Secure())
 	e.Use(setCorrectMIMETypeMiddleware)
+	e.Use(themeMiddleware)
 
 	e.Static("/css", "static/css")
 	e.Static("/assets", "static/assets")
+	e.Static("/js", "static/js")
 
 	server := Server{
-		store: s,
-		echo:  e,
+		store:    s,
+		echo:     e,
+		limiter:  limiter,
+		attempts: newAttemptLimiter(),
 	}
 
 	e.GET("/", server.HandleGetIndex)
+	e.GET("/api/languages", server.HandleGetLanguages)
+	e.GET("/themes/:theme", server.HandleGetThemeCSS)
+	e.POST("/", server.HandlePostSnippetPlain)
 	e.GET("/:id", server.HandleGetSnippet)
+	e.POST("/:id", server.HandleGetSnippet)
+	e.GET("/:id/og.png", server.HandleGetSnippetPreview)
+	e.GET("/:id/fork", server.HandleForkSnippet)
+	e.POST("/:id/fork", server.HandleForkSnippet)
+	e.GET("/:id/history", server.HandleGetSnippetHistory)
+	e.POST("/:id/history", server.HandleGetSnippetHistory)
+	e.GET("/:id/rev/:n", server.HandleGetSnippetRevision)
+	e.POST("/:id/rev/:n", server.HandleGetSnippetRevision)
+	e.GET("/diff/:a/:b", server.HandleGetDiff)
+	e.POST("/diff/:a/:b", server.HandleGetDiff)
+	e.GET("/raw/:id", server.HandleGetRawSnippet)
+	e.GET("/raw/:id/:name", server.HandleGetRawSnippet)
+	e.GET("/dl/:id", server.HandleDownloadSnippet)
+	e.GET("/dl/:id/:name", server.HandleDownloadSnippet)
 	e.POST("/snippet", server.HandlePostSnippet)
+	e.PATCH("/:id", server.HandlePatchSnippet)
+	e.DELETE("/:id", server.HandleDeleteSnippet)
 
 	return server
 }
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"binp/util"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+const (
+	// tcpIdleTimeout ends a paste once the client stops sending, since many
+	// netcat builds never half-close the connection.
+	tcpIdleTimeout = 2 * time.Second
+	tcpMaxDuration = 30 * time.Second
+)
+
+// StartTCP accepts termbin-style pastes: everything a client sends until EOF,
+// a pause or the size limit is stored as a snippet and the snippet URL is
+// written back, e.g. `echo hi | nc binp.io 9999`.
+func (s *Server) StartTCP(port string) error {
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
+	if err != nil {
+		return err
+	}
+	return s.serveTCP(ln)
+}
+
+// serveTCP handles connections until ln is closed. Each one may stay open
+// for tcpMaxDuration, so connections beyond tcpMaxConnections are turned away
+// instead of piling up.
+func (s *Server) serveTCP(ln net.Listener) error {
+	logger := util.GetLogger()
+	slots := make(chan struct{}, tcpMaxConnections())
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			logger.Error().Err(err).Msg("Error while accepting TCP connection")
+			continue
+		}
+		select {
+		case slots <- struct{}{}:
+			go func() {
+				defer func() { <-slots }()
+				s.handleTCPConn(conn)
+			}()
+		default:
+			logger.Warn().Str("remote_addr", conn.RemoteAddr().String()).Msg("Too many TCP connections")
+			conn.SetWriteDeadline(time.Now().Add(time.Second))
+			fmt.Fprint(conn, "Error: Too many connections\n")
+			conn.Close()
+		}
+	}
+}
+
+func (s *Server) handleTCPConn(conn net.Conn) {
+	defer conn.Close()
+	logger := util.GetLogger()
+	start := time.Now()
+
+	ip, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		ip = conn.RemoteAddr().String()
+	}
+	if allowed, _ := s.limiter.Allow(ip); !allowed {
+		logger.Warn().Str("remote_ip", ip).Msg("TCP paste rate limited")
+		fmt.Fprint(conn, "Error: Too many requests\n")
+		return
+	}
+
+	body, err := readTCPPaste(conn)
+	if err != nil {
+		logger.Error().Err(err).Str("remote_ip", ip).Msg("Error while reading TCP paste")
+		fmt.Fprintf(conn, "Error: %s\n", err)
+		return
+	}
+
+	snippet, _, err := s.createPlainSnippet(&PostSnippetReq{Text: string(body)})
+	if err != nil {
+		logger.Warn().Err(err).Str("remote_ip", ip).Msg("Error while creating TCP paste")
+		fmt.Fprintf(conn, "Error: %s\n", err)
+		return
+	}
+
+	logger.Info().
+		Str("remote_ip", ip).
+		Str("ID", snippet.ID).
+		Int("bytes", len(body)).
+		Dur("latency", time.Since(start)).
+		Msg("TCP paste")
+	fmt.Fprintf(conn, "%s/%s\n", baseURL(), snippet.ID)
+}
+
+// readTCPPaste reads until EOF, tcpIdleTimeout without data once something
+// has been received, or tcpMaxDuration in total.
+func readTCPPaste(conn net.Conn) ([]byte, error) {
+	deadline := time.Now().Add(tcpMaxDuration)
+	buf := make([]byte, 0, 4096)
+	chunk := make([]byte, 4096)
+	for {
+		readDeadline := deadline
+		if len(buf) > 0 {
+			if idle := time.Now().Add(tcpIdleTimeout); idle.Before(deadline) {
+				readDeadline = idle
+			}
+		}
+		conn.SetReadDeadline(readDeadline)
+
+		n, err := conn.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+		if len(buf) > maxPlainBodyBytes {
+			return nil, errors.New("Snippet too large")
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) || (errors.Is(err, os.ErrDeadlineExceeded) && len(buf) > 0) {
+				conn.SetReadDeadline(time.Time{})
+				return buf, nil
+			}
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				return nil, errors.New("No data received")
+			}
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTCPPaste(t *testing.T) {
+	t.Setenv("BINP_BASE_URL", "https://binp.test")
+	serv, store := setupTestServer(t)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	go serv.serveTCP(ln)
+
+	paste := func(text string, halfClose bool) string {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		assert.NoError(t, err)
+		defer conn.Close()
+		_, err = conn.Write([]byte(text))
+		assert.NoError(t, err)
+		if halfClose {
+			conn.(*net.TCPConn).CloseWrite()
+		}
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		assert.NoError(t, err)
+		return strings.TrimSpace(line)
+	}
+
+	url := paste("echo hello\n", true)
+	assert.True(t, strings.HasPrefix(url, "https://binp.test/"), url)
+	snippet, err := store.GetSnippetByID(strings.TrimPrefix(url, "https://binp.test/"))
+	assert.NoError(t, err)
+	assert.Equal(t, "echo hello\n", snippet.Text)
+	assert.Equal(t, "bash", snippet.Language)
+	assert.Equal(t, "bash", snippet.DetectedLanguage)
+
+	url = paste("no half close", false)
+	assert.True(t, strings.HasPrefix(url, "https://binp.test/"), url)
+
+	assert.Equal(t, "Error: Snippet too large", paste(strings.Repeat("a", maxPlainBodyBytes+1), true))
+}
+
+func TestTCPConnectionLimit(t *testing.T) {
+	t.Setenv("BINP_BASE_URL", "https://binp.test")
+	t.Setenv("TCP_MAX_CONNECTIONS", "1")
+	serv, _ := setupTestServer(t)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	go serv.serveTCP(ln)
+
+	read := func(conn net.Conn) string {
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		return strings.TrimSpace(line)
+	}
+
+	// An idle client holds the only slot.
+	idle, err := net.Dial("tcp", ln.Addr().String())
+	assert.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+
+	turnedAway, err := net.Dial("tcp", ln.Addr().String())
+	assert.NoError(t, err)
+	defer turnedAway.Close()
+	assert.Equal(t, "Error: Too many connections", read(turnedAway))
+
+	// The slot is released once the idle client leaves.
+	idle.Close()
+	assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			return false
+		}
+		defer conn.Close()
+		conn.Write([]byte("echo hi\n"))
+		conn.(*net.TCPConn).CloseWrite()
+		return strings.HasPrefix(read(conn), "https://binp.test/")
+	}, 2*time.Second, 50*time.Millisecond)
+}
@@ -0,0 +1,374 @@
+// End-to-end encryption for snippets. The browser encrypts the text with a
+// random AES-256-GCM key before it is posted and keeps the key in the URL
+// fragment, which is never sent to the server. The stored text is
+// base64(iv || ciphertext || tag) and the key is unpadded base64url.
+//
+// binp is set on window, rather than declared with const, so that
+// hyperscript handlers such as "call binp.setTheme(...)" can resolve it.
+window.binp = (() => {
+	const ENCRYPTION = "aes-256-gcm";
+
+	function toBase64(bytes) {
+		let binary = "";
+		bytes.forEach((b) => (binary += String.fromCharCode(b)));
+		return btoa(binary);
+	}
+
+	function fromBase64(value) {
+		return Uint8Array.from(atob(value), (c) => c.charCodeAt(0));
+	}
+
+	function toBase64Url(bytes) {
+		return toBase64(bytes).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+	}
+
+	function fromBase64Url(value) {
+		const padded = value.replace(/-/g, "+").replace(/_/g, "/");
+		return fromBase64(padded + "=".repeat((4 - (padded.length % 4)) % 4));
+	}
+
+	async function encrypt(text) {
+		const rawKey = crypto.getRandomValues(new Uint8Array(32));
+		const key = await crypto.subtle.importKey("raw", rawKey, "AES-GCM", false, ["encrypt"]);
+		const iv = crypto.getRandomValues(new Uint8Array(12));
+		const data = new TextEncoder().encode(text);
+		const sealed = new Uint8Array(await crypto.subtle.encrypt({ name: "AES-GCM", iv }, key, data));
+		const out = new Uint8Array(iv.length + sealed.length);
+		out.set(iv);
+		out.set(sealed, iv.length);
+		return { ciphertext: toBase64(out), key: toBase64Url(rawKey) };
+	}
+
+	async function decrypt(ciphertext, encodedKey) {
+		const data = fromBase64(ciphertext);
+		const key = await crypto.subtle.importKey("raw", fromBase64Url(encodedKey), "AES-GCM", false, ["decrypt"]);
+		const plain = await crypto.subtle.decrypt({ name: "AES-GCM", iv: data.slice(0, 12) }, key, data.slice(12));
+		return new TextDecoder().decode(plain);
+	}
+
+	// highlight.js is only loaded to highlight decrypted snippets, which the
+	// server cannot highlight, so other pages never run third-party code.
+	const HLJS_URL = "https://unpkg.com/@highlightjs/cdn-assets@11.9.0/highlight.min.js";
+	let hljsLoading = null;
+
+	function loadHighlighter() {
+		if (window.hljs) {
+			return Promise.resolve(window.hljs);
+		}
+		if (!hljsLoading) {
+			hljsLoading = new Promise((resolve, reject) => {
+				const script = document.createElement("script");
+				script.src = HLJS_URL;
+				script.crossOrigin = "anonymous";
+				script.referrerPolicy = "no-referrer";
+				script.onload = () => resolve(window.hljs);
+				script.onerror = () => {
+					hljsLoading = null;
+					reject(new Error("Failed to load highlight.js"));
+				};
+				document.head.appendChild(script);
+			});
+		}
+		return hljsLoading;
+	}
+
+	// HLJS_CLASSES maps highlight.js scopes to chroma's token classes, so
+	// that decrypted snippets follow the selected theme like the rest.
+	const HLJS_CLASSES = {
+		keyword: "k",
+		built_in: "nb",
+		type: "kt",
+		literal: "kc",
+		number: "m",
+		string: "s",
+		regexp: "sr",
+		symbol: "ss",
+		char: "sc",
+		comment: "c",
+		doctag: "cs",
+		meta: "cp",
+		title: "nf",
+		"title.class_": "nc",
+		"title.function_": "nf",
+		params: "nv",
+		variable: "nv",
+		"variable.language_": "bp",
+		attr: "na",
+		attribute: "na",
+		property: "py",
+		name: "nt",
+		tag: "nt",
+		"selector-tag": "nt",
+		"selector-class": "nc",
+		"selector-id": "ni",
+		section: "gh",
+		bullet: "k",
+		emphasis: "ge",
+		strong: "gs",
+		addition: "gi",
+		deletion: "gd",
+		operator: "o",
+		punctuation: "p",
+		subst: "si",
+		"template-variable": "si",
+		link: "nl",
+		quote: "c1",
+	};
+
+	function toChromaClasses(root) {
+		root.querySelectorAll("span[class]").forEach((span) => {
+			const [scope, ...subs] = span.className.split(" ");
+			const name = scope.replace(/^hljs-/, "");
+			span.className = HLJS_CLASSES[[name, ...subs].join(".")] || HLJS_CLASSES[name] || "";
+		});
+	}
+
+	async function highlightCode(code, text, language) {
+		const hljs = await loadHighlighter();
+		if (!hljs.getLanguage(language)) {
+			return;
+		}
+		code.innerHTML = hljs.highlight(text, { language, ignoreIllegals: true }).value;
+		toChromaClasses(code);
+	}
+
+	// decryptSnippet fills #snippet-encrypted with the plaintext, highlighted
+	// with highlight.js when it knows the language.
+	async function decryptSnippet() {
+		const el = document.getElementById("snippet-encrypted");
+		if (!el || el.dataset.decrypted) {
+			return;
+		}
+		const code = el.querySelector("code");
+		const key = window.location.hash.slice(1);
+		if (!key) {
+			code.textContent = "This snippet is encrypted and the URL is missing its key.";
+			return;
+		}
+		try {
+			const text = await decrypt(el.dataset.ciphertext, key);
+			el.dataset.decrypted = "true";
+			code.textContent = text;
+			const raw = document.getElementById("snippet-raw-text");
+			if (raw) {
+				raw.textContent = text;
+			}
+		} catch (err) {
+			code.textContent = "Failed to decrypt snippet. Check the key in the URL.";
+			return;
+		}
+		// The plaintext stays readable if highlight.js cannot be loaded.
+		highlightCode(code, code.textContent, el.dataset.language).catch(() => {});
+	}
+
+	// decryptFork fills the editor with an encrypted snippet being forked. The
+	// fork is encrypted again, with a new key, when it is submitted.
+	async function decryptFork() {
+		const textarea = document.querySelector("textarea[data-fork-ciphertext]");
+		const key = window.location.hash.slice(1);
+		if (!textarea || !key) {
+			return;
+		}
+		try {
+			textarea.value = await decrypt(textarea.dataset.forkCiphertext, key);
+			textarea.removeAttribute("data-fork-ciphertext");
+			document.getElementById("snippet-submit-btn").removeAttribute("disabled");
+		} catch (err) {
+			textarea.placeholder = "Failed to decrypt snippet. Check the key in the URL.";
+		}
+	}
+
+	// Links marked data-keep-hash carry the key of an encrypted snippet over
+	// to the next page.
+	document.addEventListener("click", (evt) => {
+		const link = evt.target.closest("a[data-keep-hash]");
+		if (link && window.location.hash) {
+			link.href = link.getAttribute("href").split("#")[0] + window.location.hash;
+		}
+	});
+
+	// pending holds the encrypted submission between htmx:confirm, which may
+	// wait for Web Crypto, and htmx:configRequest, which must be synchronous.
+	let pending = null;
+
+	document.addEventListener("htmx:confirm", (evt) => {
+		const encrypt = document.querySelector("[name='encrypt']");
+		if (evt.detail.elt.id !== "snippet-submit-btn" || !encrypt || !encrypt.checked) {
+			return;
+		}
+		evt.preventDefault();
+		const text = document.querySelector("[name='text']").value;
+		binp.encrypt(text).then((result) => {
+			pending = result;
+			evt.detail.issueRequest(true);
+		});
+	});
+
+	document.addEventListener("htmx:configRequest", (evt) => {
+		if (!pending || evt.detail.elt.id !== "snippet-submit-btn") {
+			return;
+		}
+		evt.detail.parameters["text"] = pending.ciphertext;
+		evt.detail.parameters["encryption"] = ENCRYPTION;
+		delete evt.detail.parameters["encrypt"];
+	});
+
+	// A file dropped on the editor is uploaded in place of its text.
+	document.addEventListener("dragover", (evt) => {
+		if (evt.target.closest && evt.target.closest("textarea[name='text']")) {
+			evt.preventDefault();
+		}
+	});
+
+	document.addEventListener("drop", (evt) => {
+		const file = document.querySelector("input[name='file']");
+		if (!file || !evt.target.closest || !evt.target.closest("textarea[name='text']") || !evt.dataTransfer.files.length) {
+			return;
+		}
+		evt.preventDefault();
+		const transfer = new DataTransfer();
+		transfer.items.add(evt.dataTransfer.files[0]);
+		file.files = transfer.files;
+		file.dispatchEvent(new Event("change", { bubbles: true }));
+	});
+
+	// createdKey is added to the URL once htmx has pushed the snippet URL.
+	let createdKey = null;
+
+	document.addEventListener("htmx:afterRequest", (evt) => {
+		if (!pending || evt.detail.elt.id !== "snippet-submit-btn") {
+			return;
+		}
+		if (evt.detail.successful) {
+			createdKey = pending.key;
+		}
+		pending = null;
+	});
+
+	document.addEventListener("htmx:afterSettle", () => {
+		if (createdKey) {
+			history.replaceState(history.state, "", window.location.pathname + "#" + createdKey);
+			createdKey = null;
+		}
+		decryptSnippet();
+	});
+	document.addEventListener("DOMContentLoaded", decryptSnippet);
+	document.addEventListener("DOMContentLoaded", decryptFork);
+
+	// setTheme remembers the syntax theme in a cookie and reloads the page
+	// without any ?theme= overriding it.
+	function setTheme(theme) {
+		document.cookie = `theme=${encodeURIComponent(theme)}; path=/; max-age=31536000; samesite=lax`;
+		const url = new URL(window.location.href);
+		url.searchParams.delete("theme");
+		window.location.replace(url);
+	}
+
+	// The auto theme follows prefers-color-scheme, so the dark variants of the
+	// page have to follow it too.
+	const darkScheme = window.matchMedia("(prefers-color-scheme: dark)");
+	function syncScheme() {
+		if (document.documentElement.dataset.theme === "auto") {
+			document.body.classList.toggle("dark", darkScheme.matches);
+		}
+	}
+	darkScheme.addEventListener("change", syncScheme);
+	document.addEventListener("DOMContentLoaded", syncScheme);
+
+	// Line anchors look like #L10 or #L10-L20, with a file prefix such as
+	// #file-main.go-L10 on multi-file snippets. The key of an encrypted
+	// snippet also lives in the fragment, so only fragments naming an
+	// existing line are treated as anchors.
+	const LINE_ANCHOR = /^#(.*?L)(\d+)(?:-L?(\d+))?$/;
+
+	function lineAnchor(hash) {
+		const match = LINE_ANCHOR.exec(hash);
+		if (!match) {
+			return null;
+		}
+		const prefix = decodeURIComponent(match[1]);
+		let start = Number(match[2]);
+		let end = match[3] ? Number(match[3]) : start;
+		if (end < start) {
+			[start, end] = [end, start];
+		}
+		if (!document.getElementById(prefix + start)) {
+			return null;
+		}
+		return { prefix, start, end };
+	}
+
+	// highlightLines marks the lines named by the fragment, leaving lines
+	// marked by the server with ?hl= alone.
+	function highlightLines() {
+		document.querySelectorAll(".chroma .line[data-anchored]").forEach((line) => {
+			line.classList.remove("hl");
+			delete line.dataset.anchored;
+		});
+		const anchor = lineAnchor(window.location.hash);
+		if (!anchor) {
+			return;
+		}
+		if (document.getElementById(anchor.prefix + anchor.start).closest("#snippet-source")) {
+			showDocument("snippet-source");
+		}
+		for (let n = anchor.start; n <= anchor.end; n++) {
+			const number = document.getElementById(anchor.prefix + n);
+			const line = number && number.closest(".line");
+			if (line && !line.classList.contains("hl")) {
+				line.classList.add("hl");
+				line.dataset.anchored = "true";
+			}
+		}
+		document.getElementById(anchor.prefix + anchor.start).scrollIntoView({ block: "center" });
+	}
+
+	// Shift-clicking a line number extends the selected line into a range.
+	document.addEventListener("click", (evt) => {
+		const link = evt.target.closest && evt.target.closest(".chroma .lnlinks");
+		const anchor = link && evt.shiftKey && lineAnchor(window.location.hash);
+		const target = link && lineAnchor(link.hash);
+		if (!anchor || !target || anchor.prefix !== target.prefix) {
+			return;
+		}
+		evt.preventDefault();
+		const start = Math.min(anchor.start, target.start);
+		const end = Math.max(anchor.start, target.start);
+		window.location.hash = `${anchor.prefix}${start}-L${end}`;
+	});
+	window.addEventListener("hashchange", highlightLines);
+	document.addEventListener("DOMContentLoaded", highlightLines);
+	document.addEventListener("htmx:afterSettle", highlightLines);
+
+	// Headings of rendered documents have IDs prefixed with user-content-, so
+	// that they cannot clash with the page's own, and links to #heading are
+	// followed to #user-content-heading as on GitHub.
+	function scrollToHeading() {
+		const name = decodeURIComponent(window.location.hash.slice(1));
+		if (!name || document.getElementById(name)) {
+			return;
+		}
+		const heading = document.getElementById("user-content-" + name);
+		if (heading && heading.closest("#snippet-rendered")) {
+			showDocument("snippet-rendered");
+			heading.scrollIntoView();
+		}
+	}
+	window.addEventListener("hashchange", scrollToHeading);
+	document.addEventListener("DOMContentLoaded", scrollToHeading);
+
+	// showDocument shows either the rendered form of a Markdown snippet or
+	// notebook, "snippet-rendered", or its source, "snippet-source".
+	function showDocument(panel) {
+		["snippet-rendered", "snippet-source"].forEach((id) => {
+			const el = document.getElementById(id);
+			const tab = document.getElementById(id + "-tab");
+			if (el && tab) {
+				el.hidden = id !== panel;
+				tab.setAttribute("aria-selected", String(id === panel));
+			}
+		});
+	}
+
+	return { encrypt, decrypt, setTheme, showDocument };
+})();
@@ -1,78 +1,159 @@
 package storage
 
+import (
+	"os"
+	"strconv"
+	"sync"
+)
+
+const defaultCacheMaxBytes = 32 << 20
+
 type CacheStore struct {
 	client *LRUCache
 }
 
+// NewCache creates a cache bounded by CACHE_MAX_BYTES (default 32 MiB).
 func NewCache() *CacheStore {
+	maxBytes := defaultCacheMaxBytes
+	if value := os.Getenv("CACHE_MAX_BYTES"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			logger.Warn().Str("CACHE_MAX_BYTES", value).Msg("Invalid cache size. Using default.")
+		} else {
+			maxBytes = parsed
+		}
+	}
 	return &CacheStore{
-		client: &LRUCache{
-			length:        0,
-			capacity:      100,
-			head:          nil,
-			tail:          nil,
-			lookup:        make(map[string]*Node),
-			reverseLookup: make(map[*Node]string),
-		},
+		client: NewLRUCache(maxBytes),
 	}
 }
 
+func (c *CacheStore) Stats() CacheStats {
+	return c.client.Stats()
+}
+
 type Node struct {
 	val  *Snippet
+	size int
 	prev *Node
 	next *Node
 }
 
 func createNode(val *Snippet) *Node {
 	return &Node{
-		val: val,
+		val:  val,
+		size: snippetSize(val),
 	}
 }
 
+// snippetSize is the number of bytes a snippet is charged against the cache
+// capacity.
+func snippetSize(snippet *Snippet) int {
+	size := len(snippet.Text) + len(snippet.HighlightedCode) + len(snippet.RenderedHTML)
+	for _, file := range snippet.Files {
+		size += len(file.Text) + len(file.HighlightedCode)
+	}
+	return size
+}
+
+type CacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Expired   uint64 `json:"expired"`
+	Entries   int    `json:"entries"`
+	Bytes     int    `json:"bytes"`
+	MaxBytes  int    `json:"max_bytes"`
+}
+
+// LRUCache is a least recently used cache of snippets bounded by the total
+// size of their text and highlighted code. Entries are dropped once their
+// snippet expires. It is safe for concurrent use.
 type LRUCache struct {
+	mu            sync.Mutex
 	length        int
+	size          int
 	capacity      int
 	head          *Node
 	tail          *Node
 	lookup        map[string]*Node
 	reverseLookup map[*Node]string
+	stats         CacheStats
+}
+
+func NewLRUCache(maxBytes int) *LRUCache {
+	return &LRUCache{
+		capacity:      maxBytes,
+		lookup:        make(map[string]*Node),
+		reverseLookup: make(map[*Node]string),
+	}
 }
 
 func (c *LRUCache) Get(key string) *Snippet {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	node, ok := c.lookup[key]
 	if !ok {
+		c.stats.Misses++
 		return nil
 	}
+	if node.val.IsExpired() {
+		c.remove(node)
+		c.stats.Expired++
+		c.stats.Misses++
+		return nil
+	}
+	c.stats.Hits++
 	c.detatch(node)
 	c.prepend(node)
 	return node.val
 }
 
 func (c *LRUCache) Put(key string, value *Snippet) {
-	node, ok := c.lookup[key]
-	if ok {
-		node.val = value
-		c.detatch(node)
-		c.prepend(node)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if node, ok := c.lookup[key]; ok {
+		c.remove(node)
+	}
+	node := createNode(value)
+	if node.size > c.capacity || value.IsExpired() {
 		return
 	}
-	node = createNode(value)
 	c.prepend(node)
 	c.length++
+	c.size += node.size
 	c.lookup[key] = node
 	c.reverseLookup[node] = key
 	c.trimCache()
 }
 
 func (c *LRUCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	node, ok := c.lookup[key]
 	if !ok {
 		return
 	}
+	c.remove(node)
+}
+
+func (c *LRUCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = c.length
+	stats.Bytes = c.size
+	stats.MaxBytes = c.capacity
+	return stats
+}
+
+func (c *LRUCache) remove(node *Node) {
+	key := c.reverseLookup[node]
 	c.detatch(node)
 	delete(c.lookup, key)
 	delete(c.reverseLookup, node)
 	c.length--
+	c.size -= node.size
 }
 
 func (c *LRUCache) detatch(node *Node) {
@@ -109,12 +190,8 @@ func (c *LRUCache) prepend(node *Node) {
 }
 
 func (c *LRUCache) trimCache() {
-	if c.length > c.capacity {
-		node := c.tail
-		key := c.reverseLookup[node]
-		c.detatch(node)
-		delete(c.lookup, key)
-		delete(c.reverseLookup, node)
-		c.length--
+	for c.size > c.capacity && c.tail != nil {
+		c.remove(c.tail)
+		c.stats.Evictions++
 	}
 }
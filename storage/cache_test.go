@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testSnippet(id string, size int, expiresAt time.Time) *Snippet {
+	return &Snippet{
+		ID:        id,
+		Text:      strings.Repeat("a", size),
+		ExpiresAt: expiresAt,
+	}
+}
+
+func TestLRUCacheEvictsByBytes(t *testing.T) {
+	cache := NewLRUCache(100)
+	expiresAt := time.Now().UTC().Add(time.Hour)
+
+	cache.Put("a", testSnippet("a", 40, expiresAt))
+	cache.Put("b", testSnippet("b", 40, expiresAt))
+	assert.NotNil(t, cache.Get("a"))
+
+	cache.Put("c", testSnippet("c", 40, expiresAt))
+	assert.Nil(t, cache.Get("b"))
+	assert.NotNil(t, cache.Get("a"))
+	assert.NotNil(t, cache.Get("c"))
+
+	cache.Put("huge", testSnippet("huge", 101, expiresAt))
+	assert.Nil(t, cache.Get("huge"))
+
+	stats := cache.Stats()
+	assert.Equal(t, 2, stats.Entries)
+	assert.Equal(t, 80, stats.Bytes)
+	assert.Equal(t, uint64(1), stats.Evictions)
+	assert.Equal(t, uint64(3), stats.Hits)
+	assert.Equal(t, uint64(2), stats.Misses)
+}
+
+func TestLRUCacheExpiresEntries(t *testing.T) {
+	cache := NewLRUCache(100)
+
+	cache.Put("a", testSnippet("a", 10, time.Now().UTC().Add(50*time.Millisecond)))
+	assert.NotNil(t, cache.Get("a"))
+
+	time.Sleep(60 * time.Millisecond)
+	assert.Nil(t, cache.Get("a"))
+
+	stats := cache.Stats()
+	assert.Equal(t, 0, stats.Entries)
+	assert.Equal(t, 0, stats.Bytes)
+	assert.Equal(t, uint64(1), stats.Expired)
+}
+
+func TestLRUCacheConcurrentAccess(t *testing.T) {
+	cache := NewLRUCache(1000)
+	expiresAt := time.Now().UTC().Add(time.Hour)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				key := fmt.Sprintf("%d-%d", i, j%10)
+				cache.Put(key, testSnippet(key, 10, expiresAt))
+				cache.Get(key)
+				if j%3 == 0 {
+					cache.Delete(key)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	stats := cache.Stats()
+	assert.LessOrEqual(t, stats.Bytes, 1000)
+	assert.Equal(t, stats.Entries*10, stats.Bytes)
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SnippetChange is an entry of the change log written whenever a snippet is
+// updated or deleted, by any process sharing the same database.
+type SnippetChange struct {
+	Seq       int64
+	SnippetID string
+	Operation string
+}
+
+// ChangeFeed is implemented by repositories that can be shared between
+// processes. Stores poll it to evict cache entries changed elsewhere.
+type ChangeFeed interface {
+	LatestChange() (int64, error)
+	ChangesSince(seq int64) ([]SnippetChange, error)
+	PruneChanges(olderThan time.Duration) (int, error)
+}
+
+func (s *DBStore) LatestChange() (int64, error) {
+	var seq int64
+	err := s.client.QueryRow(`SELECT COALESCE(MAX(seq), 0) FROM snippet_change`).Scan(&seq)
+	return seq, err
+}
+
+func (s *DBStore) ChangesSince(seq int64) ([]SnippetChange, error) {
+	query := `
+		SELECT seq, snippet_id, operation
+		FROM snippet_change
+		WHERE seq > ?
+		ORDER BY seq
+	`
+	rows, err := s.client.Query(query, seq)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var changes []SnippetChange
+	for rows.Next() {
+		var change SnippetChange
+		if err := rows.Scan(&change.Seq, &change.SnippetID, &change.Operation); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+func (s *DBStore) PruneChanges(olderThan time.Duration) (int, error) {
+	query := `
+		DELETE FROM snippet_change
+		WHERE created_at < datetime('now', ?)
+	`
+	res, err := s.client.Exec(query, fmt.Sprintf("%+d seconds", -int(olderThan.Seconds())))
+	if err != nil {
+		return 0, err
+	}
+	count, err := res.RowsAffected()
+	return int(count), err
+}
+
+// WatchChanges evicts cache entries for snippets changed by other processes
+// until ctx is done. It returns immediately when the repository has no change
+// feed.
+func (s *Store) WatchChanges(ctx context.Context, interval time.Duration) {
+	feed, ok := s.repo.(ChangeFeed)
+	if !ok {
+		return
+	}
+	seq, err := feed.LatestChange()
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to read snippet change log")
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			seq, err = s.syncChanges(feed, seq)
+			if err != nil {
+				logger.Error().Err(err).Msg("Failed to sync snippet changes")
+			}
+		}
+	}
+}
+
+func (s *Store) syncChanges(feed ChangeFeed, seq int64) (int64, error) {
+	changes, err := feed.ChangesSince(seq)
+	if err != nil {
+		return seq, err
+	}
+	for _, change := range changes {
+		s.cache.client.Delete(change.SnippetID)
+		seq = change.Seq
+	}
+	return seq, nil
+}
+
+// PruneChanges drops change log entries older than olderThan. It is a no-op
+// for repositories without a change feed.
+func (s *Store) PruneChanges(olderThan time.Duration) (int, error) {
+	feed, ok := s.repo.(ChangeFeed)
+	if !ok {
+		return 0, nil
+	}
+	return feed.PruneChanges(olderThan)
+}
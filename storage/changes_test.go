@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncChangesAcrossStores(t *testing.T) {
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "db.sqlite"))
+
+	apiDB, err := NewDB()
+	assert.NoError(t, err)
+	api := NewStoreWithRepository(apiDB)
+	assert.NoError(t, api.Init())
+	defer api.Close()
+
+	cronDB, err := NewDB()
+	assert.NoError(t, err)
+	cron := NewStoreWithRepository(cronDB)
+	defer cron.Close()
+
+	seq, err := apiDB.LatestChange()
+	assert.NoError(t, err)
+
+	updated, err := api.CreateSnippet("before", false, OneHour, "txt")
+	assert.NoError(t, err)
+	deleted, err := api.CreateSnippet("deleted", false, OneHour, "txt")
+	assert.NoError(t, err)
+	assert.NotNil(t, api.cache.client.Get(updated.ID))
+	assert.NotNil(t, api.cache.client.Get(deleted.ID))
+
+	other, err := cron.GetSnippetByID(updated.ID)
+	assert.NoError(t, err)
+	other.Text = "after"
+	assert.NoError(t, cron.UpdateSnippet(other))
+	assert.NoError(t, cron.DeleteSnippet(deleted.ID))
+
+	seq, err = api.syncChanges(apiDB, seq)
+	assert.NoError(t, err)
+	assert.Nil(t, api.cache.client.Get(updated.ID))
+	assert.Nil(t, api.cache.client.Get(deleted.ID))
+
+	refreshed, err := api.GetSnippetByID(updated.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "after", refreshed.Text)
+
+	// Highlighting again is not a change other processes need to see.
+	refreshed.HighlightedCode = "<pre>after</pre>"
+	assert.NoError(t, cronDB.SaveHighlight(refreshed))
+
+	changes, err := apiDB.ChangesSince(seq)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+
+	count, err := api.PruneChanges(-time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
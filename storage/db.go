@@ -2,7 +2,10 @@ package storage
 
 import (
 	"database/sql"
+	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -16,6 +19,13 @@ func NewDB() (*DBStore, error) {
 	if dbPath == "" {
 		dbPath = "./db.sqlite"
 	}
+	// Every transaction writes, so take the write lock up front rather than
+	// failing to upgrade a read lock under contention.
+	if strings.Contains(dbPath, "?") {
+		dbPath += "&_busy_timeout=5000&_txlock=immediate"
+	} else {
+		dbPath += "?_busy_timeout=5000&_txlock=immediate"
+	}
 	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
 		return nil, err
@@ -30,23 +40,384 @@ func NewDB() (*DBStore, error) {
 	}, nil
 }
 
+// Init brings the schema up to date. It refuses to run against a database
+// that was migrated by a newer binary.
 func (s *DBStore) Init() error {
-	query := `
-		CREATE TABLE IF NOT EXISTS snippet (
-			pk INTEGER PRIMARY KEY AUTOINCREMENT,
-			id TEXT UNIQUE NOT NULL,
-			text TEXT NOT NULL,
-			burn_after_read INTEGER NOT NULL DEFAULT 0,
-			language TEXT NOT NULL DEFAULT 'txt',
-			expires_at DATETIME DEFAULT NULL,
-			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
-		);
-		CREATE INDEX IF NOT EXISTS idx_snippet_expires_at ON snippet(expires_at);
-    `
-	_, err := s.client.Exec(query)
+	_, err := s.MigrateUp()
 	return err
 }
 
 func (s *DBStore) Close() error {
 	return s.client.Close()
 }
+
+const snippetColumns = "pk, id, text, burn_after_read, language, token_hash, password_hash, encryption, forked_from, filename, mime_type, detected_language, language_confidence, highlighted_html, highlight_version, rendered_html, expires_at, created_at, updated_at"
+
+func scanSnippet(row *sql.Row) (*Snippet, error) {
+	var snippet Snippet
+	var expiresAt, updatedAt sql.NullTime
+	err := row.Scan(&snippet.PK, &snippet.ID, &snippet.Text, &snippet.BurnAfterRead, &snippet.Language, &snippet.TokenHash, &snippet.PasswordHash, &snippet.Encryption, &snippet.ForkedFrom, &snippet.Filename, &snippet.MimeType, &snippet.DetectedLanguage, &snippet.LanguageConfidence, &snippet.HighlightedCode, &snippet.HighlightVersion, &snippet.RenderedHTML, &expiresAt, &snippet.CreatedAt, &updatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if expiresAt.Valid {
+		snippet.ExpiresAt = expiresAt.Time
+	}
+	snippet.UpdatedAt = snippet.CreatedAt
+	if updatedAt.Valid {
+		snippet.UpdatedAt = updatedAt.Time
+	}
+	return &snippet, nil
+}
+
+// nullTime maps the zero time to NULL.
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func (s *DBStore) CreateSnippet(snippet *Snippet) error {
+	tx, err := s.client.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+        INSERT INTO snippet (id, text, burn_after_read, language, token_hash, password_hash, encryption, forked_from, filename, mime_type, detected_language, language_confidence, highlighted_html, highlight_version, rendered_html, expires_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `
+	res, err := tx.Exec(query, snippet.ID, snippet.Text, snippet.BurnAfterRead, snippet.Language, snippet.TokenHash, snippet.PasswordHash, snippet.Encryption, snippet.ForkedFrom, snippet.Filename, snippet.MimeType, snippet.DetectedLanguage, snippet.LanguageConfidence, snippet.HighlightedCode, snippet.HighlightVersion, snippet.RenderedHTML, nullTime(snippet.ExpiresAt))
+	if err != nil {
+		return err
+	}
+	pk, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO snippet_revision (snippet_id, revision, text, language, editor_token_hash)
+		VALUES (?, 1, ?, ?, ?)
+	`
+	if _, err := tx.Exec(query, snippet.ID, snippet.Text, snippet.Language, snippet.TokenHash); err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO snippet_file (snippet_id, position, name, language, text, highlighted_html)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+	for i, file := range snippet.Files {
+		if _, err := tx.Exec(query, snippet.ID, i, file.Name, file.Language, file.Text, file.HighlightedCode); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	snippet.PK = int(pk)
+	return nil
+}
+
+func (s *DBStore) GetSnippetByID(id string) (*Snippet, error) {
+	query := `
+		SELECT ` + snippetColumns + `
+		FROM snippet
+		WHERE id = ?
+	`
+	snippet, err := scanSnippet(s.client.QueryRow(query, id))
+	if err != nil || snippet == nil {
+		return nil, err
+	}
+	snippet.Files, err = getSnippetFiles(s.client, id)
+	if err != nil {
+		return nil, err
+	}
+	return snippet, nil
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx.
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+func getSnippetFiles(q queryer, id string) ([]SnippetFile, error) {
+	query := `
+		SELECT name, language, text, highlighted_html
+		FROM snippet_file
+		WHERE snippet_id = ?
+		ORDER BY position
+	`
+	rows, err := q.Query(query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var files []SnippetFile
+	for rows.Next() {
+		var file SnippetFile
+		if err := rows.Scan(&file.Name, &file.Language, &file.Text, &file.HighlightedCode); err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
+
+func (s *DBStore) UpdateSnippet(snippet *Snippet) error {
+	tx, err := s.client.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE snippet
+		SET text = ?, burn_after_read = ?, expires_at = ?, language = ?, highlighted_html = ?, highlight_version = ?, rendered_html = ?, updated_at = ?
+		WHERE id = ?
+	`
+	res, err := tx.Exec(query, snippet.Text, snippet.BurnAfterRead, nullTime(snippet.ExpiresAt), snippet.Language, snippet.HighlightedCode, snippet.HighlightVersion, snippet.RenderedHTML, nullTime(snippet.UpdatedAt), snippet.ID)
+	if err != nil {
+		return err
+	}
+	if count, err := res.RowsAffected(); err != nil {
+		return err
+	} else if count == 0 {
+		return ErrNotFound
+	}
+	if err := saveFileHighlights(tx, snippet); err != nil {
+		return err
+	}
+
+	latest, err := scanRevision(tx.QueryRow(`
+		SELECT `+revisionColumns+`
+		FROM snippet_revision
+		WHERE snippet_id = ?
+		ORDER BY revision DESC
+		LIMIT 1
+	`, snippet.ID))
+	if err != nil {
+		return err
+	}
+	if revisionChanged(latest, snippet) {
+		number := 1
+		if latest != nil {
+			number = latest.Number + 1
+		}
+		query = `
+			INSERT INTO snippet_revision (snippet_id, revision, text, language, editor_token_hash, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`
+		if _, err := tx.Exec(query, snippet.ID, number, snippet.Text, snippet.Language, snippet.TokenHash, snippet.UpdatedAt); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *DBStore) SaveHighlight(snippet *Snippet) error {
+	tx, err := s.client.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE snippet
+		SET highlighted_html = ?, highlight_version = ?, rendered_html = ?
+		WHERE id = ?
+	`
+	if _, err := tx.Exec(query, snippet.HighlightedCode, snippet.HighlightVersion, snippet.RenderedHTML, snippet.ID); err != nil {
+		return err
+	}
+	if err := saveFileHighlights(tx, snippet); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// saveFileHighlights stores the highlighted code of the files of a snippet.
+func saveFileHighlights(tx *sql.Tx, snippet *Snippet) error {
+	query := `
+		UPDATE snippet_file
+		SET highlighted_html = ?
+		WHERE snippet_id = ? AND name = ?
+	`
+	for _, file := range snippet.Files {
+		if _, err := tx.Exec(query, file.HighlightedCode, snippet.ID, file.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *DBStore) ListStaleHighlights(version string, limit int) ([]string, error) {
+	query := `
+		SELECT id
+		FROM snippet
+		WHERE highlight_version != ?
+		AND (expires_at IS NULL OR expires_at > datetime('now'))
+		LIMIT ?
+	`
+	rows, err := s.client.Query(query, version, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *DBStore) DeleteSnippet(id string) error {
+	query := `
+		DELETE FROM snippet
+		WHERE id = ?
+	`
+	_, err := s.client.Exec(query, id)
+	return err
+}
+
+func (s *DBStore) ConsumeSnippet(id string) (*Snippet, error) {
+	tx, err := s.client.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// The files are read first as deleting the snippet deletes them too.
+	files, err := getSnippetFiles(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		DELETE FROM snippet
+		WHERE id = ?
+		RETURNING ` + snippetColumns
+	snippet, err := scanSnippet(tx.QueryRow(query, id))
+	if err != nil || snippet == nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	snippet.Files = files
+	return snippet, nil
+}
+
+func (s *DBStore) getExpiredSnippetIDs() ([]string, error) {
+	query := `
+		SELECT id
+		FROM snippet
+		WHERE expires_at <= datetime('now')
+	`
+	rows, err := s.client.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (s *DBStore) DeleteExpiredSnippets() ([]string, error) {
+	ids, err := s.getExpiredSnippetIDs()
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return ids, nil
+	}
+
+	placeholders := make([]string, len(ids))
+	for i := range ids {
+		placeholders[i] = "?"
+	}
+
+	query := fmt.Sprintf(`
+		DELETE FROM snippet
+		WHERE id IN (%s)
+	`, strings.Join(placeholders, ", "))
+
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	_, err = s.client.Exec(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+const revisionColumns = "snippet_id, revision, text, language, editor_token_hash, created_at"
+
+func scanRevision(row *sql.Row) (*Revision, error) {
+	var revision Revision
+	err := row.Scan(&revision.SnippetID, &revision.Number, &revision.Text, &revision.Language, &revision.EditorTokenHash, &revision.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &revision, nil
+}
+
+func (s *DBStore) ListRevisions(id string) ([]Revision, error) {
+	query := `
+		SELECT snippet_id, revision, language, editor_token_hash, created_at
+		FROM snippet_revision
+		WHERE snippet_id = ?
+		ORDER BY revision
+	`
+	rows, err := s.client.Query(query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var revisions []Revision
+	for rows.Next() {
+		var revision Revision
+		err := rows.Scan(&revision.SnippetID, &revision.Number, &revision.Language, &revision.EditorTokenHash, &revision.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+func (s *DBStore) GetRevision(id string, n int) (*Revision, error) {
+	query := `
+		SELECT ` + revisionColumns + `
+		FROM snippet_revision
+		WHERE snippet_id = ? AND revision = ?
+	`
+	return scanRevision(s.client.QueryRow(query, id, n))
+}
@@ -0,0 +1,31 @@
+package storage
+
+import (
+	"binp/util"
+	"math"
+)
+
+// LanguageAuto asks for the language of a snippet to be detected.
+const LanguageAuto = "auto"
+
+func isAutoLanguage(language string) bool {
+	return language == "" || language == LanguageAuto
+}
+
+// DetectLanguage picks the supported language of text, trusting a file
+// name first and then the modeline, shebang and content hints of
+// util.DetectLexer. The confidence is between 0 and 1 and is 0 when the
+// text is left as "txt".
+func DetectLanguage(text string, filename string) (string, float64) {
+	if filename != "" {
+		if language := LanguageForFilename(filename); language != "txt" {
+			return language, 1
+		}
+	}
+	lexer, confidence := util.DetectLexer(text)
+	language := languageForLexer(lexer)
+	if language == "txt" {
+		return language, 0
+	}
+	return language, math.Round(float64(confidence)*100) / 100
+}
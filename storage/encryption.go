@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"encoding/base64"
+	"errors"
+)
+
+// EncryptionAES256GCM is the only supported client-side encryption scheme.
+// Text holds base64(iv || ciphertext || tag) with a 12 byte IV, and the
+// 32 byte key travels in the URL fragment as unpadded base64url.
+const EncryptionAES256GCM = "aes-256-gcm"
+
+const (
+	gcmNonceSize = 12
+	gcmTagSize   = 16
+)
+
+var ErrInvalidCiphertext = errors.New("invalid ciphertext")
+
+func (s *Snippet) IsEncrypted() bool {
+	return s.Encryption != ""
+}
+
+// IsValidEncryption reports whether value names a supported scheme. The
+// empty string means the snippet is not encrypted.
+func IsValidEncryption(value string) bool {
+	return value == "" || value == EncryptionAES256GCM
+}
+
+// ValidateCiphertext checks that text is well-formed for the scheme. The
+// server cannot check more than that without the key.
+func ValidateCiphertext(encryption, text string) error {
+	if encryption == "" {
+		return nil
+	}
+	data, err := base64.StdEncoding.DecodeString(text)
+	if err != nil || len(data) < gcmNonceSize+gcmTagSize {
+		return ErrInvalidCiphertext
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"binp/util"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const ExpirationNever = "never"
+
+const defaultExpiryOptions = "1m,1h,1d,1w,never"
+
+var ErrInvalidExpiration = errors.New("invalid expiration")
+
+// SnippetExpiration is either a duration from now, an absolute time or never.
+type SnippetExpiration struct {
+	Never    bool
+	Duration time.Duration
+	At       time.Time
+}
+
+var (
+	OneMinute = SnippetExpiration{Duration: time.Minute}
+	OneHour   = SnippetExpiration{Duration: time.Hour}
+	OneDay    = SnippetExpiration{Duration: util.Day}
+	Never     = SnippetExpiration{Never: true}
+)
+
+// ParseExpiration accepts "never", an RFC 3339 timestamp or a duration as
+// understood by util.ParseDuration ("30m", "7d", "2w", "P1D").
+func ParseExpiration(value string) (SnippetExpiration, error) {
+	value = strings.TrimSpace(value)
+	if strings.EqualFold(value, ExpirationNever) {
+		return Never, nil
+	}
+	if at, err := time.Parse(time.RFC3339, value); err == nil {
+		return SnippetExpiration{At: at.UTC()}, nil
+	}
+	d, err := util.ParseDuration(value)
+	if err != nil {
+		return SnippetExpiration{}, fmt.Errorf("%w: %q", ErrInvalidExpiration, value)
+	}
+	return SnippetExpiration{Duration: d}, nil
+}
+
+// MaxRetention returns the longest lifetime a snippet may have, configured
+// through MAX_RETENTION. Zero means snippets may be kept forever.
+func MaxRetention() time.Duration {
+	value := os.Getenv("MAX_RETENTION")
+	if value == "" || strings.EqualFold(value, ExpirationNever) {
+		return 0
+	}
+	d, err := util.ParseDuration(value)
+	if err != nil || d < 0 {
+		logger.Warn().Str("MAX_RETENTION", value).Msg("Invalid max retention. Ignoring.")
+		return 0
+	}
+	return d
+}
+
+// Validate checks that the expiration lies in the future and within the
+// configured maximum retention.
+func (s SnippetExpiration) Validate() error {
+	maxRetention := MaxRetention()
+	if s.Never {
+		if maxRetention > 0 {
+			return fmt.Errorf("%w: snippets must expire within %s", ErrInvalidExpiration, util.FormatDuration(maxRetention))
+		}
+		return nil
+	}
+
+	now := time.Now().UTC()
+	expiresAt := s.GetExpirationTime()
+	if !expiresAt.After(now) {
+		return fmt.Errorf("%w: expiration must be in the future", ErrInvalidExpiration)
+	}
+	if maxRetention > 0 && expiresAt.Sub(now) > maxRetention {
+		return fmt.Errorf("%w: snippets must expire within %s", ErrInvalidExpiration, util.FormatDuration(maxRetention))
+	}
+	return nil
+}
+
+// GetExpirationTime returns when a snippet created now expires, or nil if it
+// never does.
+func (s SnippetExpiration) GetExpirationTime() *time.Time {
+	if s.Never {
+		return nil
+	}
+	if !s.At.IsZero() {
+		t := s.At.UTC()
+		return &t
+	}
+	t := time.Now().UTC().Add(s.Duration)
+	return &t
+}
+
+// ExpirationOptions lists the choices offered by the UI, configured through
+// EXPIRY_OPTIONS and limited by MAX_RETENTION.
+func ExpirationOptions() []SelectOption {
+	value := os.Getenv("EXPIRY_OPTIONS")
+	if value == "" {
+		value = defaultExpiryOptions
+	}
+	var options []SelectOption
+	for _, option := range strings.Split(value, ",") {
+		option = strings.TrimSpace(option)
+		expiration, err := ParseExpiration(option)
+		if err != nil || !expiration.At.IsZero() {
+			logger.Warn().Str("option", option).Msg("Invalid expiry option. Skipping.")
+			continue
+		}
+		if expiration.Validate() != nil {
+			continue
+		}
+		label := "Never"
+		if !expiration.Never {
+			label = util.FormatDuration(expiration.Duration)
+		}
+		options = append(options, SelectOption{label, option})
+	}
+	return options
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseExpiration(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected SnippetExpiration
+	}{
+		{"1m", OneMinute},
+		{"30m", SnippetExpiration{Duration: 30 * time.Minute}},
+		{"1h30m", SnippetExpiration{Duration: 90 * time.Minute}},
+		{"7d", SnippetExpiration{Duration: 7 * 24 * time.Hour}},
+		{"2w", SnippetExpiration{Duration: 14 * 24 * time.Hour}},
+		{"1d12h", SnippetExpiration{Duration: 36 * time.Hour}},
+		{"PT30M", SnippetExpiration{Duration: 30 * time.Minute}},
+		{"P1DT2H", SnippetExpiration{Duration: 26 * time.Hour}},
+		{"P2W", SnippetExpiration{Duration: 14 * 24 * time.Hour}},
+		{"never", Never},
+		{"2030-01-02T03:04:05Z", SnippetExpiration{At: time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			expiration, err := ParseExpiration(tc.value)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, expiration)
+		})
+	}
+
+	for _, value := range []string{"", "soon", "1x", "10", "P", "PT", "1m30"} {
+		_, err := ParseExpiration(value)
+		assert.True(t, errors.Is(err, ErrInvalidExpiration), value)
+	}
+}
+
+func TestExpirationMaxRetention(t *testing.T) {
+	t.Setenv("MAX_RETENTION", "1w")
+	t.Setenv("EXPIRY_OPTIONS", "1h,1d,2w,never")
+
+	assert.NoError(t, OneDay.Validate())
+	assert.Error(t, Never.Validate())
+	assert.Error(t, SnippetExpiration{Duration: 8 * 24 * time.Hour}.Validate())
+	assert.Error(t, SnippetExpiration{At: time.Now().Add(-time.Minute)}.Validate())
+	assert.Equal(t, []SelectOption{{"One Hour", "1h"}, {"One Day", "1d"}}, ExpirationOptions())
+}
+
+func TestNeverExpiringSnippet(t *testing.T) {
+	store := setupTestStore(t)
+	defer store.Close()
+
+	snippet, err := store.CreateSnippet("Forever", false, Never, "txt")
+	assert.NoError(t, err)
+	assert.True(t, snippet.ExpiresAt.IsZero())
+	assert.False(t, snippet.IsExpired())
+
+	count, err := store.DeleteExpiredSnippets()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"binp/util"
+	"errors"
+	"path/filepath"
+	"regexp"
+
+	"github.com/alecthomas/chroma/v2/lexers"
+)
+
+// SnippetFile is one named file of a multi-file snippet. The first file is
+// mirrored in the Text and Language of its snippet, so that views working
+// on a single text, like raw, diff and revisions, see the primary file.
+type SnippetFile struct {
+	Name            string `json:"name"`
+	Language        string `json:"language"`
+	Text            string `json:"text"`
+	HighlightedCode string `json:"-"`
+}
+
+// FileLinePrefix starts the IDs of the line anchors of a file, as in
+// #file-main.go-L10, so that they are unique among the files of a snippet.
+func FileLinePrefix(name string) string {
+	return "file-" + name + "-" + util.LinePrefix
+}
+
+// MaxSnippetFiles bounds the number of files in one snippet.
+const MaxSnippetFiles = 20
+
+var validFileNamePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._ -]*$`)
+
+var (
+	ErrInvalidFileName   = errors.New("invalid file name")
+	ErrDuplicateFileName = errors.New("duplicate file name")
+	ErrTooManyFiles      = errors.New("too many files")
+)
+
+// ValidateFiles checks that file names are plain, unique base names that can
+// be used in URLs and restored safely to a directory.
+func ValidateFiles(files []SnippetFile) error {
+	if len(files) > MaxSnippetFiles {
+		return ErrTooManyFiles
+	}
+	seen := make(map[string]bool, len(files))
+	for _, file := range files {
+		if len(file.Name) > 255 || !validFileNamePattern.MatchString(file.Name) {
+			return ErrInvalidFileName
+		}
+		if seen[file.Name] {
+			return ErrDuplicateFileName
+		}
+		seen[file.Name] = true
+	}
+	return nil
+}
+
+// File returns the file with the given name, or nil.
+func (s *Snippet) File(name string) *SnippetFile {
+	for i := range s.Files {
+		if s.Files[i].Name == name {
+			return &s.Files[i]
+		}
+	}
+	return nil
+}
+
+// LanguageForFilename picks the supported language whose chroma lexer
+// matches the file name, falling back to plain text.
+func LanguageForFilename(name string) string {
+	return languageForLexer(lexers.Match(filepath.Base(name)))
+}
+
+// copyFiles returns a copy of files that does not share the backing array.
+func copyFiles(files []SnippetFile) []SnippetFile {
+	if files == nil {
+		return nil
+	}
+	return append([]SnippetFile(nil), files...)
+}
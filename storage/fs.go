@@ -0,0 +1,450 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var validIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// FileStore keeps every snippet as a plain text file next to a JSON sidecar
+// holding its metadata:
+//
+//	<dir>/<id>.txt
+//	<dir>/<id>.json
+//	<dir>/<id>.revisions.json
+type FileStore struct {
+	mu  sync.RWMutex
+	dir string
+}
+
+type fileSnippetMeta struct {
+	ID            string        `json:"id"`
+	BurnAfterRead bool          `json:"burn_after_read"`
+	Language      string        `json:"language"`
+	TokenHash     string        `json:"token_hash"`
+	PasswordHash  string        `json:"password_hash"`
+	Encryption    string        `json:"encryption"`
+	ForkedFrom    string        `json:"forked_from,omitempty"`
+	Files         []SnippetFile `json:"files,omitempty"`
+	Filename      string        `json:"filename,omitempty"`
+	MimeType      string        `json:"mime_type,omitempty"`
+	Detected      string        `json:"detected_language,omitempty"`
+	Confidence    float64       `json:"language_confidence,omitempty"`
+	HTML          string        `json:"highlighted_html,omitempty"`
+	FilesHTML     []string      `json:"highlighted_files,omitempty"`
+	HTMLVersion   string        `json:"highlight_version,omitempty"`
+	Rendered      string        `json:"rendered_html,omitempty"`
+	CreatedAt     time.Time     `json:"created_at"`
+	UpdatedAt     time.Time     `json:"updated_at"`
+	ExpiresAt     *time.Time    `json:"expires_at"`
+}
+
+type fileRevision struct {
+	Number          int       `json:"revision"`
+	Text            string    `json:"text"`
+	Language        string    `json:"language"`
+	EditorTokenHash string    `json:"editor_token_hash"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if dir == "" {
+		dir = "./snippets"
+	}
+	return &FileStore{
+		dir: dir,
+	}, nil
+}
+
+func (s *FileStore) Init() error {
+	return os.MkdirAll(s.dir, 0755)
+}
+
+func (s *FileStore) Close() error {
+	return nil
+}
+
+func (s *FileStore) textPath(id string) string {
+	return filepath.Join(s.dir, id+".txt")
+}
+
+func (s *FileStore) metaPath(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (s *FileStore) revisionsPath(id string) string {
+	return filepath.Join(s.dir, id+".revisions.json")
+}
+
+func (s *FileStore) CreateSnippet(snippet *Snippet) error {
+	if !validIDPattern.MatchString(snippet.ID) {
+		return ErrInvalidID
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := os.Stat(s.metaPath(snippet.ID)); err == nil {
+		return ErrDuplicateID
+	}
+	snippet.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	snippet.UpdatedAt = snippet.CreatedAt
+	if err := s.write(snippet); err != nil {
+		return err
+	}
+	return s.addRevision(snippet, snippet.CreatedAt)
+}
+
+func (s *FileStore) GetSnippetByID(id string) (*Snippet, error) {
+	if !validIDPattern.MatchString(id) {
+		return nil, nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.read(id)
+}
+
+func (s *FileStore) UpdateSnippet(snippet *Snippet) error {
+	if !validIDPattern.MatchString(snippet.ID) {
+		return ErrInvalidID
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, err := s.read(snippet.ID)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return ErrNotFound
+	}
+	existing.Text = snippet.Text
+	existing.BurnAfterRead = snippet.BurnAfterRead
+	existing.ExpiresAt = snippet.ExpiresAt
+	existing.Language = snippet.Language
+	existing.UpdatedAt = snippet.UpdatedAt
+	setHighlight(existing, snippet)
+	if err := s.write(existing); err != nil {
+		return err
+	}
+	return s.addRevision(existing, existing.UpdatedAt)
+}
+
+func (s *FileStore) SaveHighlight(snippet *Snippet) error {
+	if !validIDPattern.MatchString(snippet.ID) {
+		return ErrInvalidID
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, err := s.read(snippet.ID)
+	if err != nil || existing == nil {
+		return err
+	}
+	setHighlight(existing, snippet)
+	return s.write(existing)
+}
+
+func (s *FileStore) ListStaleHighlights(version string, limit int) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	var ids []string
+	for _, entry := range entries {
+		if len(ids) >= limit {
+			break
+		}
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || !validIDPattern.MatchString(id) {
+			continue
+		}
+		meta, err := s.readMeta(id)
+		if err != nil {
+			return ids, err
+		}
+		if meta == nil || meta.HTMLVersion == version || (meta.ExpiresAt != nil && !meta.ExpiresAt.After(now)) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (s *FileStore) DeleteSnippet(id string) error {
+	if !validIDPattern.MatchString(id) {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.remove(id)
+}
+
+// ConsumeSnippet holds the write lock for the whole read and delete, so only
+// one caller in this process can observe the snippet.
+func (s *FileStore) ConsumeSnippet(id string) (*Snippet, error) {
+	if !validIDPattern.MatchString(id) {
+		return nil, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snippet, err := s.read(id)
+	if err != nil || snippet == nil {
+		return nil, err
+	}
+	if err := s.remove(id); err != nil {
+		return nil, err
+	}
+	return snippet, nil
+}
+
+func (s *FileStore) DeleteExpiredSnippets() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	var ids []string
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || !validIDPattern.MatchString(id) {
+			continue
+		}
+		meta, err := s.readMeta(id)
+		if err != nil {
+			return ids, err
+		}
+		if meta == nil || meta.ExpiresAt == nil || meta.ExpiresAt.After(now) {
+			continue
+		}
+		if err := s.remove(id); err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (s *FileStore) readMeta(id string) (*fileSnippetMeta, error) {
+	data, err := os.ReadFile(s.metaPath(id))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var meta fileSnippetMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+func (s *FileStore) read(id string) (*Snippet, error) {
+	meta, err := s.readMeta(id)
+	if err != nil || meta == nil {
+		return nil, err
+	}
+	text, err := os.ReadFile(s.textPath(id))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	snippet := &Snippet{
+		ID:                 meta.ID,
+		Text:               string(text),
+		BurnAfterRead:      meta.BurnAfterRead,
+		Language:           meta.Language,
+		TokenHash:          meta.TokenHash,
+		PasswordHash:       meta.PasswordHash,
+		Encryption:         meta.Encryption,
+		ForkedFrom:         meta.ForkedFrom,
+		Files:              meta.Files,
+		Filename:           meta.Filename,
+		MimeType:           meta.MimeType,
+		DetectedLanguage:   meta.Detected,
+		LanguageConfidence: meta.Confidence,
+		HighlightedCode:    meta.HTML,
+		HighlightVersion:   meta.HTMLVersion,
+		RenderedHTML:       meta.Rendered,
+		CreatedAt:          meta.CreatedAt,
+		UpdatedAt:          meta.UpdatedAt,
+	}
+	for i := range snippet.Files {
+		if i < len(meta.FilesHTML) {
+			snippet.Files[i].HighlightedCode = meta.FilesHTML[i]
+		}
+	}
+	if meta.ExpiresAt != nil {
+		snippet.ExpiresAt = *meta.ExpiresAt
+	}
+	return snippet, nil
+}
+
+// write stores the text before the sidecar so that a snippet is never visible
+// without its content.
+func (s *FileStore) write(snippet *Snippet) error {
+	meta := fileSnippetMeta{
+		ID:            snippet.ID,
+		BurnAfterRead: snippet.BurnAfterRead,
+		Language:      snippet.Language,
+		TokenHash:     snippet.TokenHash,
+		PasswordHash:  snippet.PasswordHash,
+		Encryption:    snippet.Encryption,
+		ForkedFrom:    snippet.ForkedFrom,
+		Files:         snippet.Files,
+		Filename:      snippet.Filename,
+		MimeType:      snippet.MimeType,
+		Detected:      snippet.DetectedLanguage,
+		Confidence:    snippet.LanguageConfidence,
+		HTML:          snippet.HighlightedCode,
+		Rendered:      snippet.RenderedHTML,
+		CreatedAt:     snippet.CreatedAt,
+		UpdatedAt:     snippet.UpdatedAt,
+	}
+	if snippet.HighlightVersion != "" {
+		meta.HTMLVersion = snippet.HighlightVersion
+		for _, file := range snippet.Files {
+			meta.FilesHTML = append(meta.FilesHTML, file.HighlightedCode)
+		}
+	}
+	if !snippet.ExpiresAt.IsZero() {
+		expiresAt := snippet.ExpiresAt.UTC()
+		meta.ExpiresAt = &expiresAt
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.textPath(snippet.ID), []byte(snippet.Text)); err != nil {
+		return err
+	}
+	return writeFileAtomic(s.metaPath(snippet.ID), data)
+}
+
+// remove deletes the sidecar first so that a half-deleted snippet is treated
+// as missing.
+func (s *FileStore) remove(id string) error {
+	if err := os.Remove(s.metaPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.Remove(s.textPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.Remove(s.revisionsPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore) readRevisions(id string) ([]fileRevision, error) {
+	data, err := os.ReadFile(s.revisionsPath(id))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var revisions []fileRevision
+	if err := json.Unmarshal(data, &revisions); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// addRevision appends the snippet text to its revisions file if it changed.
+// The caller must hold the write lock.
+func (s *FileStore) addRevision(snippet *Snippet, at time.Time) error {
+	revisions, err := s.readRevisions(snippet.ID)
+	if err != nil {
+		return err
+	}
+	var latest *Revision
+	if len(revisions) > 0 {
+		latest = revisions[len(revisions)-1].revision(snippet.ID)
+	}
+	if !revisionChanged(latest, snippet) {
+		return nil
+	}
+	revisions = append(revisions, fileRevision{
+		Number:          len(revisions) + 1,
+		Text:            snippet.Text,
+		Language:        snippet.Language,
+		EditorTokenHash: snippet.TokenHash,
+		CreatedAt:       at,
+	})
+	data, err := json.Marshal(revisions)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.revisionsPath(snippet.ID), data)
+}
+
+func (r fileRevision) revision(id string) *Revision {
+	return &Revision{
+		SnippetID:       id,
+		Number:          r.Number,
+		Text:            r.Text,
+		Language:        r.Language,
+		EditorTokenHash: r.EditorTokenHash,
+		CreatedAt:       r.CreatedAt,
+	}
+}
+
+func (s *FileStore) ListRevisions(id string) ([]Revision, error) {
+	if !validIDPattern.MatchString(id) {
+		return nil, nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stored, err := s.readRevisions(id)
+	if err != nil {
+		return nil, err
+	}
+	var revisions []Revision
+	for _, r := range stored {
+		revision := r.revision(id)
+		revision.Text = ""
+		revisions = append(revisions, *revision)
+	}
+	return revisions, nil
+}
+
+func (s *FileStore) GetRevision(id string, n int) (*Revision, error) {
+	if !validIDPattern.MatchString(id) {
+		return nil, nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	revisions, err := s.readRevisions(id)
+	if err != nil || n < 1 || n > len(revisions) {
+		return nil, err
+	}
+	return revisions[n-1].revision(id), nil
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
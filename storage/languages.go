@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+)
+
+// Language is a language snippets can be highlighted as. There is one for
+// every chroma lexer.
+type Language struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Aliases   []string `json:"aliases,omitempty"`
+	Filenames []string `json:"filenames,omitempty"`
+	Popular   bool     `json:"popular,omitempty"`
+}
+
+// PopularLanguages are offered first in the UI. Their IDs predate the full
+// lexer list and are kept as is, so that stored snippets keep resolving.
+var PopularLanguages = []SelectOption{
+	{"Plaintext", "txt"},
+	{"Bash", "bash"},
+	{"CSS", "css"},
+	{"Docker", "dockerfile"},
+	{"Go", "go"},
+	{"HTML", "html"},
+	{"JavaScript", "javascript"},
+	{"JSON", "json"},
+	{"Lua", "lua"},
+	{"Nix", "nix"},
+	{"Python", "python"},
+	{"Rust", "rust"},
+	{"SQL", "sql"},
+	{"TOML", "toml"},
+	{"TypeScript", "typescript"},
+	{"YAML", "yaml"},
+}
+
+type languageRegistry struct {
+	languages []Language
+	byLexer   map[chroma.Lexer]*Language
+}
+
+var (
+	registryOnce sync.Once
+	registry     languageRegistry
+)
+
+// languages builds the language list from the chroma lexer registry once.
+func languages() *languageRegistry {
+	registryOnce.Do(func() {
+		popular := make(map[chroma.Lexer]SelectOption)
+		for _, option := range PopularLanguages {
+			popular[lexers.Get(option.Value)] = option
+		}
+
+		taken := make(map[string]bool)
+		registry.byLexer = make(map[chroma.Lexer]*Language)
+		for _, lexer := range lexers.GlobalLexerRegistry.Lexers {
+			config := lexer.Config()
+			language := Language{
+				ID:        languageID(lexer, taken),
+				Name:      config.Name,
+				Aliases:   config.Aliases,
+				Filenames: config.Filenames,
+			}
+			if option, ok := popular[lexer]; ok {
+				language.ID = option.Value
+				language.Popular = true
+			}
+			taken[language.ID] = true
+			registry.byLexer[lexer] = &language
+		}
+		for _, language := range registry.byLexer {
+			registry.languages = append(registry.languages, *language)
+		}
+		sort.Slice(registry.languages, func(i, j int) bool {
+			return strings.ToLower(registry.languages[i].Name) < strings.ToLower(registry.languages[j].Name)
+		})
+	})
+	return &registry
+}
+
+// languageIDPattern keeps IDs safe to use in URLs and on the command line.
+var languageIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// languageID is the lower-cased name of a lexer or, if that does not make a
+// usable ID, its first alias that does. Lexers without either fall back to
+// any alias that resolves to them.
+func languageID(lexer chroma.Lexer, taken map[string]bool) string {
+	config := lexer.Config()
+	for _, candidate := range append([]string{config.Name}, config.Aliases...) {
+		candidate = strings.ToLower(candidate)
+		if languageIDPattern.MatchString(candidate) && !taken[candidate] && lexers.Get(candidate) == lexer {
+			return candidate
+		}
+	}
+	for _, alias := range config.Aliases {
+		if alias = strings.ToLower(alias); !taken[alias] && lexers.Get(alias) == lexer {
+			return alias
+		}
+	}
+	return strings.ToLower(config.Name)
+}
+
+// Languages returns every supported language, sorted by name.
+func Languages() []Language {
+	return languages().languages
+}
+
+// LanguageOptions lists every supported language for a dropdown, popular
+// ones first.
+func LanguageOptions() []SelectOption {
+	options := append([]SelectOption(nil), PopularLanguages...)
+	for _, language := range Languages() {
+		if !language.Popular {
+			options = append(options, SelectOption{language.Name, language.ID})
+		}
+	}
+	return options
+}
+
+// NormalizeLanguage resolves a language ID, alias, name or file extension,
+// like "golang" or "yml", to the ID it is stored as.
+func NormalizeLanguage(value string) (string, bool) {
+	if value == "" {
+		return "", false
+	}
+	if language := languages().byLexer[lexers.Get(value)]; language != nil {
+		return language.ID, true
+	}
+	return "", false
+}
+
+func IsValidLanguage(value string) bool {
+	_, ok := NormalizeLanguage(value)
+	return ok
+}
+
+// normalizeLanguage returns the stored ID of a language, or the value as is
+// when it is not a known language.
+func normalizeLanguage(value string) string {
+	if language, ok := NormalizeLanguage(value); ok {
+		return language
+	}
+	return value
+}
+
+// LanguageLabel returns the display name of a supported language.
+func LanguageLabel(value string) string {
+	if language := languages().byLexer[lexers.Get(value)]; language != nil {
+		for _, option := range PopularLanguages {
+			if option.Value == language.ID {
+				return option.Label
+			}
+		}
+		return language.Name
+	}
+	return value
+}
+
+// languageForLexer maps a chroma lexer to its language, or "txt".
+func languageForLexer(lexer chroma.Lexer) string {
+	if language := languages().byLexer[lexer]; lexer != nil && language != nil {
+		return language.ID
+	}
+	return "txt"
+}
@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps snippets in process memory. Everything is lost when the
+// process exits, which makes it useful for throwaway instances and tests.
+type MemoryStore struct {
+	mu        sync.RWMutex
+	nextPK    int
+	snippets  map[string]Snippet
+	revisions map[string][]Revision
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		snippets:  make(map[string]Snippet),
+		revisions: make(map[string][]Revision),
+	}
+}
+
+func (s *MemoryStore) Init() error {
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+func (s *MemoryStore) CreateSnippet(snippet *Snippet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.snippets[snippet.ID]; ok {
+		return ErrDuplicateID
+	}
+	s.nextPK++
+	snippet.PK = s.nextPK
+	snippet.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	snippet.UpdatedAt = snippet.CreatedAt
+	stored := *snippet
+	stored.Files = copyFiles(snippet.Files)
+	s.snippets[snippet.ID] = stored
+	s.addRevision(snippet, snippet.CreatedAt)
+	return nil
+}
+
+func (s *MemoryStore) GetSnippetByID(id string) (*Snippet, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snippet, ok := s.snippets[id]
+	if !ok {
+		return nil, nil
+	}
+	snippet.Files = copyFiles(snippet.Files)
+	return &snippet, nil
+}
+
+func (s *MemoryStore) UpdateSnippet(snippet *Snippet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, ok := s.snippets[snippet.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	existing.Text = snippet.Text
+	existing.BurnAfterRead = snippet.BurnAfterRead
+	existing.ExpiresAt = snippet.ExpiresAt
+	existing.Language = snippet.Language
+	existing.UpdatedAt = snippet.UpdatedAt
+	setHighlight(&existing, snippet)
+	s.snippets[snippet.ID] = existing
+	s.addRevision(&existing, existing.UpdatedAt)
+	return nil
+}
+
+func (s *MemoryStore) SaveHighlight(snippet *Snippet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, ok := s.snippets[snippet.ID]
+	if !ok {
+		return nil
+	}
+	setHighlight(&existing, snippet)
+	s.snippets[snippet.ID] = existing
+	return nil
+}
+
+func (s *MemoryStore) ListStaleHighlights(version string, limit int) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var ids []string
+	for id, snippet := range s.snippets {
+		if len(ids) >= limit {
+			break
+		}
+		if snippet.HighlightVersion != version && !snippet.IsExpired() {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// addRevision records the snippet text as its next revision if it changed.
+// The caller must hold the write lock.
+func (s *MemoryStore) addRevision(snippet *Snippet, at time.Time) {
+	revisions := s.revisions[snippet.ID]
+	var latest *Revision
+	if len(revisions) > 0 {
+		latest = &revisions[len(revisions)-1]
+	}
+	if !revisionChanged(latest, snippet) {
+		return
+	}
+	s.revisions[snippet.ID] = append(revisions, Revision{
+		SnippetID:       snippet.ID,
+		Number:          len(revisions) + 1,
+		Text:            snippet.Text,
+		Language:        snippet.Language,
+		EditorTokenHash: snippet.TokenHash,
+		CreatedAt:       at,
+	})
+}
+
+func (s *MemoryStore) DeleteSnippet(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.snippets, id)
+	delete(s.revisions, id)
+	return nil
+}
+
+func (s *MemoryStore) ConsumeSnippet(id string) (*Snippet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snippet, ok := s.snippets[id]
+	if !ok {
+		return nil, nil
+	}
+	delete(s.snippets, id)
+	delete(s.revisions, id)
+	return &snippet, nil
+}
+
+func (s *MemoryStore) DeleteExpiredSnippets() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	var ids []string
+	for id, snippet := range s.snippets {
+		if !snippet.ExpiresAt.IsZero() && !snippet.ExpiresAt.After(now) {
+			delete(s.snippets, id)
+			delete(s.revisions, id)
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (s *MemoryStore) ListRevisions(id string) ([]Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var revisions []Revision
+	for _, revision := range s.revisions[id] {
+		revision.Text = ""
+		revisions = append(revisions, revision)
+	}
+	return revisions, nil
+}
+
+func (s *MemoryStore) GetRevision(id string, n int) (*Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	revisions := s.revisions[id]
+	if n < 1 || n > len(revisions) {
+		return nil, nil
+	}
+	revision := revisions[n-1]
+	return &revision, nil
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupMigrationDB(t *testing.T) *DBStore {
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "db.sqlite"))
+	db, err := NewDB()
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	db := setupMigrationDB(t)
+
+	migrations, err := loadMigrations()
+	assert.NoError(t, err)
+	latest := migrations[len(migrations)-1].Version
+
+	count, err := db.MigrateUp()
+	assert.NoError(t, err)
+	assert.Equal(t, len(migrations), count)
+
+	version, err := db.SchemaVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, latest, version)
+
+	count, err = db.MigrateUp()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	statuses, err := db.MigrationStatus()
+	assert.NoError(t, err)
+	for _, status := range statuses {
+		assert.True(t, status.Applied)
+	}
+
+	count, err = db.MigrateDown(len(migrations))
+	assert.NoError(t, err)
+	assert.Equal(t, len(migrations), count)
+
+	version, err = db.SchemaVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, version)
+
+	assert.NoError(t, db.Init())
+}
+
+func TestInitRefusesNewerSchema(t *testing.T) {
+	db := setupMigrationDB(t)
+	assert.NoError(t, db.Init())
+
+	_, err := db.client.Exec(`INSERT INTO schema_version (version, name) VALUES (?, ?)`, 99999, "future")
+	assert.NoError(t, err)
+
+	err = db.Init()
+	assert.True(t, errors.Is(err, ErrSchemaTooNew))
+}
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS snippet (
+	pk INTEGER PRIMARY KEY AUTOINCREMENT,
+	id TEXT UNIQUE NOT NULL,
+	text TEXT NOT NULL,
+	burn_after_read INTEGER NOT NULL DEFAULT 0,
+	language TEXT NOT NULL DEFAULT 'txt',
+	expires_at DATETIME DEFAULT NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_snippet_expires_at ON snippet(expires_at);
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS trg_snippet_change_delete;
+DROP TRIGGER IF EXISTS trg_snippet_change_update;
+DROP INDEX IF EXISTS idx_snippet_change_created_at;
+DROP TABLE IF EXISTS snippet_change;
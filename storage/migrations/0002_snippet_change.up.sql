@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS snippet_change (
+	seq INTEGER PRIMARY KEY AUTOINCREMENT,
+	snippet_id TEXT NOT NULL,
+	operation TEXT NOT NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_snippet_change_created_at ON snippet_change(created_at);
+
+CREATE TRIGGER IF NOT EXISTS trg_snippet_change_update AFTER UPDATE ON snippet
+WHEN OLD.text IS NOT NEW.text
+	OR OLD.burn_after_read IS NOT NEW.burn_after_read
+	OR OLD.language IS NOT NEW.language
+	OR OLD.expires_at IS NOT NEW.expires_at
+BEGIN
+	INSERT INTO snippet_change (snippet_id, operation) VALUES (OLD.id, 'update');
+END;
+
+CREATE TRIGGER IF NOT EXISTS trg_snippet_change_delete AFTER DELETE ON snippet
+BEGIN
+	INSERT INTO snippet_change (snippet_id, operation) VALUES (OLD.id, 'delete');
+END;
@@ -0,0 +1 @@
+ALTER TABLE snippet DROP COLUMN token_hash;
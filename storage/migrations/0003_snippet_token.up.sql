@@ -0,0 +1 @@
+ALTER TABLE snippet ADD COLUMN token_hash TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE snippet ADD COLUMN updated_at DATETIME DEFAULT NULL;
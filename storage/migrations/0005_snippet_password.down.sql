@@ -0,0 +1 @@
+ALTER TABLE snippet DROP COLUMN password_hash;
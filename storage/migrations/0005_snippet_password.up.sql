@@ -0,0 +1 @@
+ALTER TABLE snippet ADD COLUMN password_hash TEXT NOT NULL DEFAULT '';
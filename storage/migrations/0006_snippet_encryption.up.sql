@@ -0,0 +1 @@
+ALTER TABLE snippet ADD COLUMN encryption TEXT NOT NULL DEFAULT '';
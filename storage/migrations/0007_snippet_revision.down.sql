@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS trg_snippet_revision_delete;
+DROP TABLE IF EXISTS snippet_revision;
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS snippet_revision (
+	pk INTEGER PRIMARY KEY AUTOINCREMENT,
+	snippet_id TEXT NOT NULL,
+	revision INTEGER NOT NULL,
+	text TEXT NOT NULL,
+	language TEXT NOT NULL,
+	editor_token_hash TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (snippet_id, revision)
+);
+
+INSERT INTO snippet_revision (snippet_id, revision, text, language, editor_token_hash, created_at)
+SELECT id, 1, text, language, token_hash, COALESCE(updated_at, created_at) FROM snippet;
+
+CREATE TRIGGER IF NOT EXISTS trg_snippet_revision_delete AFTER DELETE ON snippet
+BEGIN
+	DELETE FROM snippet_revision WHERE snippet_id = OLD.id;
+END;
@@ -0,0 +1 @@
+ALTER TABLE snippet ADD COLUMN forked_from TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS trg_snippet_file_delete;
+DROP TABLE IF EXISTS snippet_file;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS snippet_file (
+	pk INTEGER PRIMARY KEY AUTOINCREMENT,
+	snippet_id TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	language TEXT NOT NULL,
+	text TEXT NOT NULL,
+	UNIQUE (snippet_id, name)
+);
+
+CREATE TRIGGER IF NOT EXISTS trg_snippet_file_delete AFTER DELETE ON snippet
+BEGIN
+	DELETE FROM snippet_file WHERE snippet_id = OLD.id;
+END;
@@ -0,0 +1,2 @@
+ALTER TABLE snippet DROP COLUMN mime_type;
+ALTER TABLE snippet DROP COLUMN filename;
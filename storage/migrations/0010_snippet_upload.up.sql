@@ -0,0 +1,2 @@
+ALTER TABLE snippet ADD COLUMN filename TEXT NOT NULL DEFAULT '';
+ALTER TABLE snippet ADD COLUMN mime_type TEXT NOT NULL DEFAULT '';
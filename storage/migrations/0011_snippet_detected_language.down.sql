@@ -0,0 +1,2 @@
+ALTER TABLE snippet DROP COLUMN language_confidence;
+ALTER TABLE snippet DROP COLUMN detected_language;
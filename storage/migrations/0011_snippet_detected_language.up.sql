@@ -0,0 +1,2 @@
+ALTER TABLE snippet ADD COLUMN detected_language TEXT NOT NULL DEFAULT '';
+ALTER TABLE snippet ADD COLUMN language_confidence REAL NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+ALTER TABLE snippet_file DROP COLUMN highlighted_html;
+ALTER TABLE snippet DROP COLUMN highlight_version;
+ALTER TABLE snippet DROP COLUMN highlighted_html;
@@ -0,0 +1,3 @@
+ALTER TABLE snippet ADD COLUMN highlighted_html TEXT NOT NULL DEFAULT '';
+ALTER TABLE snippet ADD COLUMN highlight_version TEXT NOT NULL DEFAULT '';
+ALTER TABLE snippet_file ADD COLUMN highlighted_html TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE snippet ADD COLUMN rendered_html TEXT NOT NULL DEFAULT '';
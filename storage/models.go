@@ -2,9 +2,8 @@ package storage
 
 import (
 	"binp/util"
-	"database/sql"
-	"fmt"
-	"strings"
+	"encoding/json"
+	"errors"
 	"time"
 
 	gonanoid "github.com/matoous/go-nanoid"
@@ -13,265 +12,357 @@ import (
 var logger = util.GetLogger()
 
 type Snippet struct {
-	PK              int       `json:"-"`
-	ID              string    `json:"id"`
-	Text            string    `json:"text"`
-	BurnAfterRead   bool      `json:"burn_after_read"`
-	Language        string    `json:"language"`
-	HighlightedCode string    `json:"-"`
-	CreatedAt       time.Time `json:"created_at"`
-	ExpiresAt       time.Time `json:"expires_at"`
+	PK            int           `json:"-"`
+	ID            string        `json:"id"`
+	Text          string        `json:"text"`
+	BurnAfterRead bool          `json:"burn_after_read"`
+	Language      string        `json:"language"`
+	Encryption    string        `json:"encryption,omitempty"`
+	ForkedFrom    string        `json:"forked_from,omitempty"`
+	Files         []SnippetFile `json:"files,omitempty"`
+	Filename      string        `json:"filename,omitempty"`
+	MimeType      string        `json:"mime_type,omitempty"`
+	// DetectedLanguage and LanguageConfidence are set when the language was
+	// detected rather than given. Language may later be changed by hand.
+	DetectedLanguage   string    `json:"detected_language,omitempty"`
+	LanguageConfidence float64   `json:"language_confidence,omitempty"`
+	HighlightedCode    string    `json:"-"`
+	HighlightVersion   string    `json:"-"`
+	RenderedHTML       string    `json:"-"`
+	TokenHash          string    `json:"-"`
+	PasswordHash       string    `json:"-"`
+	Token              string    `json:"token,omitempty"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+	ExpiresAt          time.Time `json:"expires_at"`
 }
 
-type SelectOption struct {
-	Label string
-	Value string
+// IsExpired reports whether the snippet has passed its expiration time.
+// Snippets without an expiration never expire.
+func (s *Snippet) IsExpired() bool {
+	return !s.ExpiresAt.IsZero() && !s.ExpiresAt.After(time.Now().UTC())
 }
 
-type SnippetExpiration int
-
-const (
-	OneMinute SnippetExpiration = iota
-	OneHour
-	OneDay
-)
-
-var ValidLanguages = []SelectOption{
-	{"Plaintext", "txt"},
-	{"Bash", "bash"},
-	{"CSS", "css"},
-	{"Docker", "dockerfile"},
-	{"Go", "go"},
-	{"HTML", "html"},
-	{"JavaScript", "javascript"},
-	{"JSON", "json"},
-	{"Lua", "lua"},
-	{"Nix", "nix"},
-	{"Python", "python"},
-	{"Rust", "rust"},
-	{"SQL", "sql"},
-	{"TOML", "toml"},
-	{"TypeScript", "typescript"},
-	{"YAML", "yaml"},
-}
-
-var ValidExpirations = []SelectOption{
-	{"One Minute", "1m"},
-	{"One Hour", "1h"},
-	{"One Day", "1d"},
-}
-
-func GetValidLanguages() []string {
-	var langs []string
-	for _, v := range ValidLanguages {
-		langs = append(langs, v.Value)
+// MarshalJSON encodes a missing expiration as null rather than the zero time.
+// The raw bytes of binary uploads are left out; they are only served by the
+// download route.
+func (s Snippet) MarshalJSON() ([]byte, error) {
+	type snippetJSON Snippet
+	if s.IsBinary() {
+		s.Text = ""
 	}
-	return langs
-}
-
-func GetValidExpirations() []string {
-	var expirations []string
-	for _, v := range ValidExpirations {
-		expirations = append(expirations, v.Value)
+	var expiresAt *time.Time
+	if !s.ExpiresAt.IsZero() {
+		expiresAt = &s.ExpiresAt
 	}
-	return expirations
+	return json.Marshal(struct {
+		snippetJSON
+		ExpiresAt *time.Time `json:"expires_at"`
+	}{snippetJSON(s), expiresAt})
 }
 
-func IsValidExpiration(value string) bool {
-	for _, v := range ValidExpirations {
-		if v.Value == value {
-			return true
-		}
-	}
-	return false
+type SelectOption struct {
+	Label string
+	Value string
 }
 
-func IsValidLanguage(value string) bool {
-	for _, v := range ValidLanguages {
-		if v.Value == value {
-			return true
-		}
-	}
-	return false
+// CreateSnippetParams describes a snippet to create.
+type CreateSnippetParams struct {
+	Text          string
+	BurnAfterRead bool
+	Expiry        SnippetExpiration
+	// Language is detected from the text, and Filename if set, when it is
+	// empty or LanguageAuto. Aliases are stored as the language ID.
+	Language string
+	// Password, when set, is required to read the snippet.
+	Password string
+	// Encryption names the algorithm Text was encrypted with by the client.
+	// The server never sees the key.
+	Encryption string
+	// ForkedFrom is the ID of the snippet this one was forked from.
+	ForkedFrom string
+	// Files makes a multi-file snippet. Text and Language are then taken
+	// from the first file. The language of files is detected the same way.
+	Files []SnippetFile
+	// Filename and MimeType describe an uploaded file.
+	Filename string
+	MimeType string
 }
 
-func GetSnippetExpiration(value string) SnippetExpiration {
-	switch value {
-	case "1m":
-		return OneMinute
-	case "1h":
-		return OneHour
-	case "1d":
-		return OneDay
-	default:
-		return OneMinute
-	}
+func (s *Store) CreateSnippet(text string, burnAfterRead bool, expiry SnippetExpiration, language string) (*Snippet, error) {
+	return s.CreateSnippetWithParams(CreateSnippetParams{
+		Text:          text,
+		BurnAfterRead: burnAfterRead,
+		Expiry:        expiry,
+		Language:      language,
+	})
 }
 
-func (s SnippetExpiration) GetExpirationTime() *time.Time {
-	switch s {
-	case OneMinute:
-		t := time.Now().UTC().Add(time.Minute)
-		return &t
-	case OneHour:
-		t := time.Now().UTC().Add(time.Hour)
-		return &t
-	case OneDay:
-		t := time.Now().UTC().Add(time.Hour * 24)
-		return &t
-	default:
-		return nil
+func (s *Store) CreateSnippetWithParams(params CreateSnippetParams) (*Snippet, error) {
+	id, err := gonanoid.Nanoid()
+	if err != nil {
+		return nil, err
 	}
-}
 
-func (s *Store) CreateSnippet(text string, burnAfterRead bool, expiry SnippetExpiration, language string) (*Snippet, error) {
-	id, err := gonanoid.Nanoid()
+	token, err := generateToken()
 	if err != nil {
 		return nil, err
 	}
 
-	var expiresAt *time.Time
-	if expirationTime := expiry.GetExpirationTime(); expirationTime != nil {
-		expiresAt = expirationTime
+	snippet := &Snippet{
+		ID:            id,
+		Text:          params.Text,
+		BurnAfterRead: params.BurnAfterRead,
+		Language:      params.Language,
+		Encryption:    params.Encryption,
+		ForkedFrom:    params.ForkedFrom,
+		Filename:      params.Filename,
+		MimeType:      params.MimeType,
+		TokenHash:     HashToken(token),
+	}
+	if len(params.Files) > 0 {
+		if err := ValidateFiles(params.Files); err != nil {
+			return nil, err
+		}
+		snippet.Files = copyFiles(params.Files)
+		for i := range snippet.Files {
+			file := &snippet.Files[i]
+			if isAutoLanguage(file.Language) {
+				file.Language, _ = DetectLanguage(file.Text, file.Name)
+			} else {
+				file.Language = normalizeLanguage(file.Language)
+			}
+		}
+		snippet.Text = snippet.Files[0].Text
+		snippet.Language = snippet.Files[0].Language
+	} else if isAutoLanguage(snippet.Language) {
+		snippet.DetectedLanguage = "txt"
+		if !snippet.IsEncrypted() && !snippet.IsBinary() {
+			language, confidence := DetectLanguage(snippet.Text, snippet.Filename)
+			snippet.DetectedLanguage = language
+			snippet.LanguageConfidence = confidence
+		}
+		snippet.Language = snippet.DetectedLanguage
+	} else {
+		snippet.Language = normalizeLanguage(snippet.Language)
+	}
+	if expirationTime := params.Expiry.GetExpirationTime(); expirationTime != nil {
+		snippet.ExpiresAt = *expirationTime
+	}
+	if params.Password != "" {
+		snippet.PasswordHash, err = HashPassword(params.Password)
+		if err != nil {
+			return nil, err
+		}
 	}
+	highlightSnippet(snippet)
 
-	query := `
-        INSERT INTO snippet (id, text, burn_after_read, language, expires_at)
-        VALUES (?, ?, ?, ?, ?)
-    `
-	_, err = s.db.client.Exec(query, id, text, burnAfterRead, language, expiresAt)
-	if err != nil {
+	if err := s.repo.CreateSnippet(snippet); err != nil {
 		return nil, err
 	}
 
-	snippet, err := s.GetSnippetByID(id)
-	if err != nil {
+	snippet, err = s.GetSnippetByID(id)
+	if err != nil || snippet == nil {
 		return nil, err
 	}
 
-	return snippet, nil
+	// The cached snippet must never carry the token, so hand out a copy.
+	created := *snippet
+	created.Token = token
+	return &created, nil
 }
 
 func (s *Store) GetSnippetByID(id string) (*Snippet, error) {
 	if snippet := s.cache.client.Get(id); snippet != nil {
 		return snippet, nil
 	}
-	query := `
-		SELECT pk, id, text, burn_after_read, language, expires_at, created_at
-		FROM snippet
-		WHERE id = ?
-	`
-	row := s.db.client.QueryRow(query, id)
-	var snippet Snippet
-	var expiresAt sql.NullTime
-	err := row.Scan(&snippet.PK, &snippet.ID, &snippet.Text, &snippet.BurnAfterRead, &snippet.Language, &expiresAt, &snippet.CreatedAt)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
+	snippet, err := s.repo.GetSnippetByID(id)
+	if err != nil || snippet == nil {
 		return nil, err
 	}
-	if expiresAt.Valid {
-		snippet.ExpiresAt = expiresAt.Time
-	}
-	highlightedCode, err := util.HighlightCode(snippet.Text, snippet.Language)
-	if err != nil {
-		logger.Error().Err(err).Msg("Failed to highlight code")
-		highlightedCode = snippet.Text
+	if isStale(snippet) {
+		highlightSnippet(snippet)
+		if err := s.repo.SaveHighlight(snippet); err != nil {
+			logger.Error().Err(err).Str("id", id).Msg("Failed to save highlighted code")
+		}
 	}
-	snippet.HighlightedCode = highlightedCode
-	s.cache.client.Put(id, &snippet)
-	return &snippet, nil
+	s.cache.client.Put(id, snippet)
+	return snippet, nil
 }
 
 func (s *Store) UpdateSnippet(snippet *Snippet) error {
-	query := `
-		UPDATE snippet
-		SET text = ?, burn_after_read = ?, expires_at = ?, language = ?
-		WHERE id = ?
-	`
-	_, err := s.db.client.Exec(query, snippet.Text, snippet.BurnAfterRead, snippet.ExpiresAt, snippet.Language, snippet.ID)
-	if err != nil {
+	snippet.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	snippet.Language = normalizeLanguage(snippet.Language)
+	snippet.Files = copyFiles(snippet.Files)
+	highlightSnippet(snippet)
+	if err := s.repo.UpdateSnippet(snippet); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			s.cache.client.Delete(snippet.ID)
+		}
 		return err
 	}
-	highlightedCode, err := util.HighlightCode(snippet.Text, snippet.Language)
-	if err != nil {
-		logger.Error().Err(err).Msg("Failed to highlight code")
-		highlightedCode = snippet.Text
-	}
-	snippet.HighlightedCode = highlightedCode
-	s.cache.client.Put(snippet.ID, snippet)
+	cached := *snippet
+	cached.Token = ""
+	s.cache.client.Put(snippet.ID, &cached)
 	return nil
 }
 
 func (s *Store) DeleteSnippet(id string) error {
-	query := `
-		DELETE FROM snippet
-		WHERE id = ?
-	`
-	_, err := s.db.client.Exec(query, id)
-	if err != nil {
+	if err := s.repo.DeleteSnippet(id); err != nil {
 		return err
 	}
 	s.cache.client.Delete(id)
 	return nil
 }
 
-func (s *Store) getExpiredSnippetIDs() ([]string, error) {
-	query := `
-		SELECT id
-		FROM snippet
-		WHERE expires_at <= datetime('now')
-	`
-	rows, err := s.db.client.Query(query)
-	if err != nil {
+// ConsumeSnippet reads and deletes a snippet in one step. It is used for
+// burn-after-read snippets and always bypasses the cache, returning nil if
+// another reader consumed the snippet first.
+func (s *Store) ConsumeSnippet(id string) (*Snippet, error) {
+	s.cache.client.Delete(id)
+	snippet, err := s.repo.ConsumeSnippet(id)
+	s.cache.client.Delete(id)
+	if err != nil || snippet == nil {
 		return nil, err
 	}
-	defer rows.Close()
-	var ids []string
-	for rows.Next() {
-		var id string
-		err := rows.Scan(&id)
-		if err != nil {
-			return nil, err
-		}
-		ids = append(ids, id)
+	if isStale(snippet) {
+		highlightSnippet(snippet)
 	}
-	return ids, nil
+	return snippet, nil
 }
 
 func (s *Store) DeleteExpiredSnippets() (int, error) {
-	ids, err := s.getExpiredSnippetIDs()
+	ids, err := s.repo.DeleteExpiredSnippets()
 	if err != nil {
 		return len(ids), err
 	}
-	if len(ids) == 0 {
-		return len(ids), nil
+
+	for _, id := range ids {
+		s.cache.client.Delete(id)
+	}
+
+	return len(ids), nil
+}
+
+// rehighlightBatchSize is the number of stale snippets RehighlightSnippets
+// loads at a time.
+const rehighlightBatchSize = 100
+
+// RehighlightSnippets renders every snippet whose stored HTML is stale, as it
+// is after the chroma style or version changes, and returns how many were
+// rendered. Snippets are otherwise only rendered again when they are read.
+func (s *Store) RehighlightSnippets() (int, error) {
+	version := util.HighlightVersion()
+	count := 0
+	for {
+		ids, err := s.repo.ListStaleHighlights(version, rehighlightBatchSize)
+		if err != nil {
+			return count, err
+		}
+		for _, id := range ids {
+			snippet, err := s.repo.GetSnippetByID(id)
+			if err != nil {
+				return count, err
+			}
+			if snippet == nil || !isStale(snippet) {
+				continue
+			}
+			highlightSnippet(snippet)
+			if err := s.repo.SaveHighlight(snippet); err != nil {
+				return count, err
+			}
+			s.cache.client.Delete(id)
+			count++
+		}
+		if len(ids) < rehighlightBatchSize {
+			return count, nil
+		}
 	}
+}
+
+// isStale reports whether the stored HTML of a snippet was rendered by a
+// different style or version of chroma.
+func isStale(snippet *Snippet) bool {
+	return snippet.HighlightVersion != util.HighlightVersion()
+}
 
-	placeholders := make([]string, len(ids))
-	for i := range ids {
-		placeholders[i] = "?"
+// highlightSnippet highlights a snippet and each of its files, and renders
+// it when it is a document.
+func highlightSnippet(snippet *Snippet) {
+	snippet.HighlightVersion = util.HighlightVersion()
+	snippet.HighlightedCode = highlight(snippet, util.HighlightOptions{})
+	snippet.RenderedHTML = render(snippet)
+	for i := range snippet.Files {
+		file := &snippet.Files[i]
+		file.HighlightedCode = highlight(&Snippet{Text: file.Text, Language: file.Language, Encryption: snippet.Encryption}, util.HighlightOptions{
+			LinePrefix: FileLinePrefix(file.Name),
+		})
 	}
+}
 
-	query := fmt.Sprintf(`
-		DELETE FROM snippet
-		WHERE id IN (%s)
-	`, strings.Join(placeholders, ", "))
+// setHighlight copies the highlighted code of src, and of its files by name,
+// to dst. Repositories use it to keep the rendered HTML of a stored snippet.
+func setHighlight(dst, src *Snippet) {
+	dst.HighlightedCode = src.HighlightedCode
+	dst.HighlightVersion = src.HighlightVersion
+	dst.RenderedHTML = src.RenderedHTML
+	dst.Files = copyFiles(dst.Files)
+	for i := range dst.Files {
+		for _, file := range src.Files {
+			if file.Name == dst.Files[i].Name {
+				dst.Files[i].HighlightedCode = file.HighlightedCode
+			}
+		}
+	}
+}
 
-	args := make([]interface{}, len(ids))
-	for i, id := range ids {
-		args[i] = id
+// HighlightAs returns a copy of snippet highlighted as language with lines
+// marked, to view it differently from how it is stored. Documents are only
+// rendered when no lines are marked, since those are in the source.
+func HighlightAs(snippet *Snippet, language string, lines []util.LineRange) *Snippet {
+	viewed := *snippet
+	viewed.Language = language
+	viewed.HighlightedCode = highlight(&viewed, util.HighlightOptions{Lines: lines})
+	viewed.RenderedHTML = ""
+	if len(lines) == 0 {
+		viewed.RenderedHTML = render(&viewed)
 	}
+	return &viewed
+}
 
-	_, err = s.db.client.Exec(query, args...)
+// highlight renders a snippet with chroma. Encrypted snippets are only
+// ciphertext to the server and are highlighted in the browser instead, and
+// binary uploads are not highlighted at all.
+func highlight(snippet *Snippet, options util.HighlightOptions) string {
+	if snippet.IsEncrypted() || snippet.IsBinary() {
+		return ""
+	}
+	highlightedCode, err := util.HighlightCodeWithOptions(snippet.Text, snippet.Language, options)
 	if err != nil {
-		return len(ids), err
+		logger.Error().Err(err).Msg("Failed to highlight code")
+		highlightedCode = snippet.Text
 	}
+	return highlightedCode
+}
 
-	for _, id := range ids {
-		s.cache.client.Delete(id)
+// render renders Markdown snippets and Jupyter notebooks, which are stored
+// as JSON, to sanitized HTML. Other snippets, and those the server cannot
+// read, render to "".
+func render(snippet *Snippet) string {
+	if snippet.IsEncrypted() || snippet.IsBinary() || len(snippet.Files) > 0 {
+		return ""
 	}
-
-	return len(ids), nil
+	var rendered string
+	var err error
+	switch {
+	case snippet.Language == "markdown":
+		rendered, err = util.RenderMarkdown(snippet.Text)
+	case snippet.Language == "json" && util.IsNotebook(snippet.Text):
+		rendered, err = util.RenderNotebook(snippet.Text)
+	}
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to render document")
+		return ""
+	}
+	return rendered
 }
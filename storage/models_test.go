@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"binp/util"
 	"os"
 	"testing"
 	"time"
@@ -16,17 +17,12 @@ func setupTestStore(t *testing.T) *Store {
 	err = dbStore.Init()
 	assert.NoError(t, err)
 
-	cacheStore := NewCache()
-
-	return &Store{
-		db:    dbStore,
-		cache: cacheStore,
-	}
+	return NewStoreWithRepository(dbStore)
 }
 
 func TestCreateSnippet(t *testing.T) {
 	store := setupTestStore(t)
-	defer store.db.Close()
+	defer store.Close()
 
 	testCases := []struct {
 		name             string
@@ -78,7 +74,7 @@ func TestCreateSnippet(t *testing.T) {
 
 func TestGetSnippetByID(t *testing.T) {
 	store := setupTestStore(t)
-	defer store.db.Close()
+	defer store.Close()
 
 	createdSnippet, err := store.CreateSnippet("Test snippet", false, OneHour, "txt")
 	assert.NoError(t, err)
@@ -109,7 +105,7 @@ func TestGetSnippetByID(t *testing.T) {
 
 func TestDeleteSnippet(t *testing.T) {
 	store := setupTestStore(t)
-	defer store.db.Close()
+	defer store.Close()
 
 	snippet, err := store.CreateSnippet("Test snippet", false, OneHour, "txt")
 	assert.NoError(t, err)
@@ -129,7 +125,7 @@ func TestDeleteSnippet(t *testing.T) {
 
 func TestUpdateSnippet(t *testing.T) {
 	store := setupTestStore(t)
-	defer store.db.Close()
+	defer store.Close()
 
 	snippet, err := store.CreateSnippet("Test snippet", false, OneHour, "txt")
 	assert.NoError(t, err)
@@ -148,9 +144,28 @@ func TestUpdateSnippet(t *testing.T) {
 	assert.Equal(t, "go", updatedSnippet.Language)
 }
 
+func TestUpdateDeletedSnippet(t *testing.T) {
+	store := setupTestStore(t)
+	defer store.Close()
+
+	snippet, err := store.CreateSnippet("Deleted snippet", false, OneHour, "txt")
+	assert.NoError(t, err)
+	assert.NotNil(t, store.cache.client.Get(snippet.ID))
+
+	// Another request deletes the snippet while this one edits it.
+	assert.NoError(t, store.repo.DeleteSnippet(snippet.ID))
+	snippet.Text = "Edited"
+	assert.ErrorIs(t, store.UpdateSnippet(snippet), ErrNotFound)
+
+	assert.Nil(t, store.cache.client.Get(snippet.ID))
+	deleted, err := store.GetSnippetByID(snippet.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, deleted)
+}
+
 func TestGetExpiredSnippetIDs(t *testing.T) {
 	store := setupTestStore(t)
-	defer store.db.Close()
+	defer store.Close()
 
 	expiredSnippet, err := store.CreateSnippet("Expired snippet", false, OneHour, "txt")
 	assert.NoError(t, err)
@@ -162,7 +177,7 @@ func TestGetExpiredSnippetIDs(t *testing.T) {
 	_, err = store.CreateSnippet("Valid snippet", false, OneDay, "txt")
 	assert.NoError(t, err)
 
-	ids, err := store.getExpiredSnippetIDs()
+	ids, err := store.repo.(*DBStore).getExpiredSnippetIDs()
 	assert.NoError(t, err)
 
 	assert.Len(t, ids, 1)
@@ -171,7 +186,7 @@ func TestGetExpiredSnippetIDs(t *testing.T) {
 
 func TestDeleteExpiredSnippets(t *testing.T) {
 	store := setupTestStore(t)
-	defer store.db.Close()
+	defer store.Close()
 
 	expiredSnippet, err := store.CreateSnippet("Expired snippet", false, OneHour, "txt")
 	assert.NoError(t, err)
@@ -200,3 +215,117 @@ func TestDeleteExpiredSnippets(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, existingSnippet)
 }
+
+func TestLanguageForFilename(t *testing.T) {
+	assert.Equal(t, "go", LanguageForFilename("main.go"))
+	assert.Equal(t, "yaml", LanguageForFilename("deploy/config.yml"))
+	assert.Equal(t, "dockerfile", LanguageForFilename("Dockerfile"))
+	assert.Equal(t, "txt", LanguageForFilename("notes"))
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		filename string
+		language string
+	}{
+		{"filename", "anything", "main.rs", "rust"},
+		{"shebang", "#!/usr/bin/env python3\nprint(1)\n", "", "python"},
+		{"shebang node", "#!/usr/bin/node\nconsole.log(1)\n", "", "javascript"},
+		{"vim modeline", "x = 1\n# vim: set ft=lua:\n", "", "lua"},
+		{"emacs modeline", "# -*- mode: yaml -*-\na: 1\n", "", "yaml"},
+		{"go", "package main\n\nfunc main() {}\n", "", "go"},
+		{"json", `{"a": [1, 2]}`, "", "json"},
+		{"python", "def main():\n    pass\n", "", "python"},
+		{"sql", "SELECT id FROM snippet WHERE id = 1;", "", "sql"},
+		{"dockerfile", "FROM golang:1.22\nRUN go build\n", "", "dockerfile"},
+		{"plain", "just some words", "", "txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			language, confidence := DetectLanguage(tt.text, tt.filename)
+			assert.Equal(t, tt.language, language)
+			if language == "txt" {
+				assert.Zero(t, confidence)
+			} else {
+				assert.Greater(t, confidence, 0.0)
+			}
+		})
+	}
+
+	store := setupTestStore(t)
+	defer store.Close()
+	snippet, err := store.CreateSnippet("package main\n\nfunc main() {}\n", false, OneHour, LanguageAuto)
+	assert.NoError(t, err)
+	assert.Equal(t, "go", snippet.Language)
+	assert.Equal(t, "go", snippet.DetectedLanguage)
+	snippet, err = store.CreateSnippet("package main\n", false, OneHour, "txt")
+	assert.NoError(t, err)
+	assert.Empty(t, snippet.DetectedLanguage)
+}
+
+func TestLanguages(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, language := range Languages() {
+		assert.False(t, seen[language.ID], "duplicate language %q", language.ID)
+		seen[language.ID] = true
+		id, ok := NormalizeLanguage(language.ID)
+		assert.True(t, ok, language.ID)
+		assert.Equal(t, language.ID, id)
+	}
+	for _, option := range PopularLanguages {
+		assert.True(t, seen[option.Value], option.Value)
+	}
+
+	for alias, id := range map[string]string{"golang": "go", "yml": "yaml", "py": "python", "Go": "go", "sh": "bash", "kotlin": "kotlin"} {
+		language, ok := NormalizeLanguage(alias)
+		assert.True(t, ok, alias)
+		assert.Equal(t, id, language, alias)
+	}
+	assert.False(t, IsValidLanguage("not-a-language"))
+	assert.False(t, IsValidLanguage(""))
+	assert.Equal(t, "Go", LanguageLabel("golang"))
+}
+
+func TestStoredHighlight(t *testing.T) {
+	store := setupTestStore(t)
+	defer store.Close()
+
+	snippet, err := store.CreateSnippet("package main\n", false, OneHour, "go")
+	assert.NoError(t, err)
+	stored, err := store.repo.GetSnippetByID(snippet.ID)
+	assert.NoError(t, err)
+	assert.Contains(t, stored.HighlightedCode, "chroma")
+	assert.Equal(t, util.HighlightVersion(), stored.HighlightVersion)
+
+	makeStale := func() {
+		stale := *stored
+		stale.HighlightedCode = "stale"
+		stale.HighlightVersion = "old"
+		assert.NoError(t, store.repo.SaveHighlight(&stale))
+		store.cache.client.Delete(snippet.ID)
+	}
+
+	// Stale HTML is rendered again when the snippet is read.
+	makeStale()
+	found, err := store.GetSnippetByID(snippet.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, stored.HighlightedCode, found.HighlightedCode)
+	stored, err = store.repo.GetSnippetByID(snippet.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, util.HighlightVersion(), stored.HighlightVersion)
+
+	makeStale()
+	count, err := store.RehighlightSnippets()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	stored, err = store.repo.GetSnippetByID(snippet.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, found.HighlightedCode, stored.HighlightedCode)
+	assert.Equal(t, util.HighlightVersion(), stored.HighlightVersion)
+
+	count, err = store.RehighlightSnippets()
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+var (
+	ErrDuplicateID = errors.New("snippet id already exists")
+	ErrInvalidID   = errors.New("invalid snippet id")
+	ErrNotFound    = errors.New("snippet not found")
+)
+
+// IsValidID reports whether id has the shape of a snippet ID.
+func IsValidID(id string) bool {
+	return validIDPattern.MatchString(id)
+}
+
+// SnippetRepository is the persistence layer behind a Store. Implementations
+// only deal with raw snippet data; highlighting and caching are handled by
+// the Store itself, which hands them the rendered HTML to keep alongside the
+// text. CreateSnippet and UpdateSnippet also record a Revision whenever the
+// text or language changes.
+type SnippetRepository interface {
+	Init() error
+	Close() error
+	CreateSnippet(snippet *Snippet) error
+	GetSnippetByID(id string) (*Snippet, error)
+	// UpdateSnippet returns ErrNotFound if the snippet has been deleted, for
+	// example by a concurrent delete or read of a burn-after-read snippet.
+	UpdateSnippet(snippet *Snippet) error
+	DeleteSnippet(id string) error
+	// ConsumeSnippet atomically reads and deletes a snippet so that it can
+	// only ever be returned once. It returns nil if the snippet does not exist.
+	ConsumeSnippet(id string) (*Snippet, error)
+	// DeleteExpiredSnippets removes every expired snippet and returns the IDs
+	// that were deleted.
+	DeleteExpiredSnippets() ([]string, error)
+	// SaveHighlight stores the highlighted code and highlight version of a
+	// snippet and its files, leaving everything else as it is.
+	SaveHighlight(snippet *Snippet) error
+	// ListStaleHighlights returns up to limit IDs of unexpired snippets whose
+	// highlight version is not version.
+	ListStaleHighlights(version string, limit int) ([]string, error)
+	// ListRevisions returns the revisions of a snippet, oldest first. Text is
+	// left empty.
+	ListRevisions(id string) ([]Revision, error)
+	// GetRevision returns revision n of a snippet, or nil if it does not
+	// exist.
+	GetRevision(id string, n int) (*Revision, error)
+}
+
+const (
+	BackendSQLite = "sqlite"
+	BackendMemory = "memory"
+	BackendFS     = "fs"
+)
+
+// NewRepository creates the repository selected by the STORAGE_BACKEND
+// environment variable. SQLite is used when it is unset.
+func NewRepository() (SnippetRepository, error) {
+	backend := os.Getenv("STORAGE_BACKEND")
+	switch backend {
+	case "", BackendSQLite:
+		return NewDB()
+	case BackendMemory:
+		return NewMemoryStore(), nil
+	case BackendFS:
+		return NewFileStore(os.Getenv("STORAGE_PATH"))
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
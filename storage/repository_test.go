@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testRepositories(t *testing.T) map[string]SnippetRepository {
+	t.Setenv("DB_PATH", ":memory:")
+	db, err := NewDB()
+	assert.NoError(t, err)
+
+	fs, err := NewFileStore(t.TempDir())
+	assert.NoError(t, err)
+
+	return map[string]SnippetRepository{
+		BackendSQLite: db,
+		BackendMemory: NewMemoryStore(),
+		BackendFS:     fs,
+	}
+}
+
+func TestRepositories(t *testing.T) {
+	for name, repo := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, repo.Init())
+			defer repo.Close()
+
+			snippet := &Snippet{
+				ID:         "repo-test",
+				Text:       "fmt.Println(\"hi\")",
+				Language:   "go",
+				ForkedFrom: "repo-parent",
+				ExpiresAt:  time.Now().UTC().Add(time.Hour).Truncate(time.Second),
+			}
+			assert.NoError(t, repo.CreateSnippet(snippet))
+
+			found, err := repo.GetSnippetByID(snippet.ID)
+			assert.NoError(t, err)
+			assert.NotNil(t, found)
+			assert.Equal(t, snippet.Text, found.Text)
+			assert.Equal(t, snippet.Language, found.Language)
+			assert.Equal(t, snippet.ForkedFrom, found.ForkedFrom)
+			assert.True(t, snippet.ExpiresAt.Equal(found.ExpiresAt))
+			assert.False(t, found.CreatedAt.IsZero())
+
+			found.Text = "updated"
+			found.ExpiresAt = time.Now().UTC().Add(-time.Hour)
+			assert.NoError(t, repo.UpdateSnippet(found))
+
+			updated, err := repo.GetSnippetByID(snippet.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, "updated", updated.Text)
+
+			ids, err := repo.DeleteExpiredSnippets()
+			assert.NoError(t, err)
+			assert.Equal(t, []string{snippet.ID}, ids)
+
+			deleted, err := repo.GetSnippetByID(snippet.ID)
+			assert.NoError(t, err)
+			assert.Nil(t, deleted)
+			assert.ErrorIs(t, repo.UpdateSnippet(found), ErrNotFound)
+
+			missing, err := repo.GetSnippetByID("../../etc/passwd")
+			assert.NoError(t, err)
+			assert.Nil(t, missing)
+		})
+	}
+}
+
+func TestRepositoriesConsumeSnippet(t *testing.T) {
+	for name, repo := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, repo.Init())
+			defer repo.Close()
+
+			snippet := &Snippet{
+				ID:            "consume-test",
+				Text:          "secret",
+				BurnAfterRead: true,
+				Language:      "txt",
+				ExpiresAt:     time.Now().UTC().Add(time.Hour),
+			}
+			assert.NoError(t, repo.CreateSnippet(snippet))
+
+			consumed, err := repo.ConsumeSnippet(snippet.ID)
+			assert.NoError(t, err)
+			assert.NotNil(t, consumed)
+			assert.Equal(t, "secret", consumed.Text)
+			assert.True(t, consumed.BurnAfterRead)
+			assert.False(t, consumed.CreatedAt.IsZero())
+
+			again, err := repo.ConsumeSnippet(snippet.ID)
+			assert.NoError(t, err)
+			assert.Nil(t, again)
+		})
+	}
+}
+
+func TestRepositoriesRevisions(t *testing.T) {
+	for name, repo := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, repo.Init())
+			defer repo.Close()
+
+			snippet := &Snippet{ID: "revision-test", Text: "v1", Language: "txt", TokenHash: "abcdef0123456789"}
+			assert.NoError(t, repo.CreateSnippet(snippet))
+
+			snippet.Text = "v2"
+			snippet.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+			assert.NoError(t, repo.UpdateSnippet(snippet))
+
+			// Changing only the settings does not add a revision.
+			snippet.BurnAfterRead = true
+			assert.NoError(t, repo.UpdateSnippet(snippet))
+
+			revisions, err := repo.ListRevisions(snippet.ID)
+			assert.NoError(t, err)
+			assert.Len(t, revisions, 2)
+			assert.Equal(t, 1, revisions[0].Number)
+			assert.Equal(t, 2, revisions[1].Number)
+			assert.Equal(t, "abcdef0123456789", revisions[1].EditorTokenHash)
+
+			first, err := repo.GetRevision(snippet.ID, 1)
+			assert.NoError(t, err)
+			assert.Equal(t, "v1", first.Text)
+
+			missing, err := repo.GetRevision(snippet.ID, 3)
+			assert.NoError(t, err)
+			assert.Nil(t, missing)
+
+			_, err = repo.ConsumeSnippet(snippet.ID)
+			assert.NoError(t, err)
+			revisions, err = repo.ListRevisions(snippet.ID)
+			assert.NoError(t, err)
+			assert.Empty(t, revisions)
+		})
+	}
+}
+
+func TestRepositoriesFiles(t *testing.T) {
+	for name, repo := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, repo.Init())
+			defer repo.Close()
+
+			files := []SnippetFile{
+				{Name: "main.go", Language: "go", Text: "package main"},
+				{Name: "config.yaml", Language: "yaml", Text: "a: 1"},
+			}
+			snippet := &Snippet{ID: "files-test", Text: files[0].Text, Language: files[0].Language, Files: files}
+			assert.NoError(t, repo.CreateSnippet(snippet))
+
+			found, err := repo.GetSnippetByID(snippet.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, files, found.Files)
+
+			consumed, err := repo.ConsumeSnippet(snippet.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, files, consumed.Files)
+		})
+	}
+}
+
+func TestRepositoriesHighlight(t *testing.T) {
+	for name, repo := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, repo.Init())
+			defer repo.Close()
+
+			files := []SnippetFile{
+				{Name: "main.go", Language: "go", Text: "package main", HighlightedCode: "<main.go>"},
+				{Name: "config.yaml", Language: "yaml", Text: "a: 1", HighlightedCode: "<config.yaml>"},
+			}
+			snippet := &Snippet{ID: "highlight-test", Text: files[0].Text, Language: "go", Files: files, HighlightedCode: "<old>", HighlightVersion: "v1"}
+			assert.NoError(t, repo.CreateSnippet(snippet))
+			expired := &Snippet{ID: "highlight-expired", Text: "old", Language: "txt", ExpiresAt: time.Now().UTC().Add(-time.Hour)}
+			assert.NoError(t, repo.CreateSnippet(expired))
+
+			found, err := repo.GetSnippetByID(snippet.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, "<old>", found.HighlightedCode)
+			assert.Equal(t, "v1", found.HighlightVersion)
+			assert.Equal(t, files, found.Files)
+
+			ids, err := repo.ListStaleHighlights("v2", 10)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{snippet.ID}, ids)
+
+			found.HighlightedCode = "<new>"
+			found.HighlightVersion = "v2"
+			found.Files[1].HighlightedCode = "<new config.yaml>"
+			assert.NoError(t, repo.SaveHighlight(found))
+
+			saved, err := repo.GetSnippetByID(snippet.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, "<new>", saved.HighlightedCode)
+			assert.Equal(t, "v2", saved.HighlightVersion)
+			assert.Equal(t, "<main.go>", saved.Files[0].HighlightedCode)
+			assert.Equal(t, "<new config.yaml>", saved.Files[1].HighlightedCode)
+
+			ids, err = repo.ListStaleHighlights("v2", 10)
+			assert.NoError(t, err)
+			assert.Empty(t, ids)
+		})
+	}
+}
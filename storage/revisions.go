@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"binp/util"
+	"time"
+)
+
+// Revision is one version of a snippet's text. Revision 1 is the text the
+// snippet was created with and every edit of its text or language adds the
+// next one. Revisions are deleted together with their snippet, so they share
+// its expiry and burn-after-read lifetime.
+type Revision struct {
+	SnippetID       string    `json:"snippet_id"`
+	Number          int       `json:"revision"`
+	Text            string    `json:"text"`
+	Language        string    `json:"language"`
+	Encryption      string    `json:"encryption,omitempty"`
+	EditorTokenHash string    `json:"-"`
+	Editor          string    `json:"editor"`
+	HighlightedCode string    `json:"-"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// editorFingerprint shortens the hash of the token used for an edit so that
+// revisions made with the same token can be told apart without exposing it.
+func editorFingerprint(tokenHash string) string {
+	if len(tokenHash) > 8 {
+		return tokenHash[:8]
+	}
+	return tokenHash
+}
+
+// revisionChanged reports whether an update to snippet differs from the
+// latest revision and so needs a new one.
+func revisionChanged(latest *Revision, snippet *Snippet) bool {
+	return latest == nil || latest.Text != snippet.Text || latest.Language != snippet.Language
+}
+
+// ListRevisions returns the revisions of a snippet, oldest first, without
+// their text.
+func (s *Store) ListRevisions(snippet *Snippet) ([]Revision, error) {
+	revisions, err := s.repo.ListRevisions(snippet.ID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range revisions {
+		revisions[i].Editor = editorFingerprint(revisions[i].EditorTokenHash)
+		revisions[i].Encryption = snippet.Encryption
+	}
+	return revisions, nil
+}
+
+// GetRevision returns revision n of a snippet, highlighted like the snippet
+// itself. It returns nil if the revision does not exist.
+func (s *Store) GetRevision(snippet *Snippet, n int) (*Revision, error) {
+	revision, err := s.repo.GetRevision(snippet.ID, n)
+	if err != nil || revision == nil {
+		return nil, err
+	}
+	revision.Editor = editorFingerprint(revision.EditorTokenHash)
+	revision.Encryption = snippet.Encryption
+	revision.HighlightedCode = highlight(&Snippet{
+		Text:       revision.Text,
+		Language:   revision.Language,
+		Encryption: revision.Encryption,
+	}, util.HighlightOptions{})
+	return revision, nil
+}
+
+// AsSnippet returns the revision as a snippet of parent for rendering.
+func (r *Revision) AsSnippet(parent *Snippet) *Snippet {
+	return &Snippet{
+		ID:              parent.ID,
+		Text:            r.Text,
+		BurnAfterRead:   parent.BurnAfterRead,
+		Language:        r.Language,
+		Encryption:      parent.Encryption,
+		HighlightedCode: r.HighlightedCode,
+		CreatedAt:       r.CreatedAt,
+		UpdatedAt:       r.CreatedAt,
+		ExpiresAt:       parent.ExpiresAt,
+	}
+}
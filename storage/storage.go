@@ -1,27 +1,37 @@
 package storage
 
 type Store struct {
-	db    *DBStore
+	repo  SnippetRepository
 	cache *CacheStore
 }
 
 func NewStore() (*Store, error) {
-	dbStore, err := NewDB()
+	repo, err := NewRepository()
 	if err != nil {
 		return nil, err
 	}
 
-	cacheStore := NewCache()
+	return NewStoreWithRepository(repo), nil
+}
 
+func NewStoreWithRepository(repo SnippetRepository) *Store {
 	return &Store{
-		db:    dbStore,
-		cache: cacheStore,
-	}, nil
+		repo:  repo,
+		cache: NewCache(),
+	}
 }
 
 func (s *Store) Init() error {
-	if err := s.db.Init(); err != nil {
+	if err := s.repo.Init(); err != nil {
 		return err
 	}
 	return nil
 }
+
+func (s *Store) Close() error {
+	return s.repo.Close()
+}
+
+func (s *Store) CacheStats() CacheStats {
+	return s.cache.Stats()
+}
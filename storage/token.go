@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// generateToken returns the secret management token handed to the author of
+// a snippet. Only its hash is ever stored.
+func generateToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashToken hashes a management token. Tokens are random and long, so a fast
+// hash is sufficient.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyToken reports whether token is the management token of the snippet.
+func (s *Snippet) VerifyToken(token string) bool {
+	if s.TokenHash == "" || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(s.TokenHash), []byte(HashToken(token))) == 1
+}
+
+// MaxPasswordBytes is the length of the longest password bcrypt can hash.
+// It is counted in bytes, so it allows fewer characters outside ASCII.
+const MaxPasswordBytes = 72
+
+// HashPassword hashes a snippet password with bcrypt. Unlike tokens,
+// passwords are chosen by people and need a slow hash.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// IsProtected reports whether reading the snippet requires a password.
+func (s *Snippet) IsProtected() bool {
+	return s.PasswordHash != ""
+}
+
+// VerifyPassword reports whether password unlocks the snippet.
+func (s *Snippet) VerifyPassword(password string) bool {
+	if !s.IsProtected() {
+		return true
+	}
+	return bcrypt.CompareHashAndPassword([]byte(s.PasswordHash), []byte(password)) == nil
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// IsBinary reports whether the snippet is an uploaded file that is not
+// text. Its Text then holds the raw bytes and it is never highlighted.
+func (s *Snippet) IsBinary() bool {
+	return s.MimeType != "" && !IsTextMIME(s.MimeType)
+}
+
+// IsTextMIME reports whether a MIME type is shown as text.
+func IsTextMIME(mimeType string) bool {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return false
+	}
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/xml", "application/javascript", "application/x-sh", "application/toml", "application/yaml", "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// DetectMIMEType determines the MIME type of an upload. The file extension
+// is preferred since content sniffing reports most source code as
+// text/plain, but content that is not valid UTF-8 is never reported as text.
+func DetectMIMEType(filename string, data []byte) string {
+	byName := mime.TypeByExtension(filepath.Ext(filename))
+	if !utf8.Valid(data) {
+		if byName != "" && !IsTextMIME(byName) {
+			return byName
+		}
+		if sniffed := http.DetectContentType(data); !IsTextMIME(sniffed) {
+			return sniffed
+		}
+		return "application/octet-stream"
+	}
+	if byName != "" {
+		return byName
+	}
+	return http.DetectContentType(data)
+}
@@ -1,10 +1,15 @@
 package util
 
 import (
+	"fmt"
 	"os"
-	"regexp"
+	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
+	"github.com/alecthomas/chroma/v2"
 	"github.com/alecthomas/chroma/v2/formatters/html"
 	"github.com/alecthomas/chroma/v2/lexers"
 	"github.com/alecthomas/chroma/v2/styles"
@@ -12,86 +17,175 @@ import (
 
 var logger = GetLogger()
 
+// highlightRevision is bumped whenever the way HighlightCode renders changes,
+// such as its formatter options, so that stored HTML is rendered again. The
+// HTML only refers to CSS classes, so it does not depend on the theme.
+const highlightRevision = 4
+
+var highlightVersion = sync.OnceValue(func() string {
+	version := "unknown"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == "github.com/alecthomas/chroma/v2" {
+				version = dep.Version
+				if dep.Replace != nil {
+					version = dep.Replace.Version
+				}
+				break
+			}
+		}
+	}
+	return fmt.Sprintf("chroma@%s/%d", version, highlightRevision)
+})
+
+// HighlightVersion identifies the output of HighlightCode: the chroma version
+// and the revision of the renderer. HTML stored with a different version is
+// stale.
+func HighlightVersion() string {
+	return highlightVersion()
+}
+
+// chromaStyle returns the style passed to the HTML formatter. As it only
+// writes classes, the output is styled by chroma.css instead.
+func chromaStyle() *chroma.Style {
+	return styles.Get(defaultDarkTheme)
+}
+
+// GenerateChromaCSS writes static/css/chroma.css with the rules of every
+// theme in Themes, each scoped to [data-theme="<name>"], and of ThemeAuto,
+// which picks the light or dark theme with prefers-color-scheme.
 func GenerateChromaCSS() error {
 	logger.Info().Msg("Generating chroma.css...")
 
-	style := styles.Get("tokyonight-night")
-	if style == nil {
-		style = styles.Fallback
+	var buf strings.Builder
+	writeRules(&buf, baseRules, "")
+	for _, name := range Themes() {
+		fmt.Fprintf(&buf, "\n/* %s */\n", name)
+		writeRules(&buf, themeRules(styles.Get(name), themeScope(name)), "")
+	}
+	for _, scheme := range []struct{ media, theme string }{{"light", LightTheme()}, {"dark", DarkTheme()}} {
+		fmt.Fprintf(&buf, "\n/* %s: %s */\n@media (prefers-color-scheme: %s) {\n", ThemeAuto, scheme.theme, scheme.media)
+		writeRules(&buf, themeRules(styles.Get(scheme.theme), themeScope(ThemeAuto)), "\t")
+		buf.WriteString("}\n")
 	}
-	formatter := html.New(html.WithClasses(true))
 
-	var buffer strings.Builder
-	err := formatter.WriteCSS(&buffer, style)
+	err := os.WriteFile("static/css/chroma.css", []byte(buf.String()), 0644)
 	if err != nil {
-		logger.Error().Err(err).Msg("Failed to generate chroma.css")
+		logger.Error().Err(err).Msg("Failed to write chroma.css")
 		return err
 	}
 
-	css := buffer.String()
-
-	re := regexp.MustCompile(`background-color:\s*[^;]+;`)
-	css = re.ReplaceAllString(css, "")
+	logger.Info().Strs("themes", Themes()).Msg("Generated chroma.css")
+	return nil
+}
 
-	re = regexp.MustCompile(`[^\{\}]+\{\s*\}`)
-	css = re.ReplaceAllString(css, "")
+// lexerFor returns the chroma lexer for language, detecting one from the
+// code when chroma does not know the language.
+func lexerFor(code, language string) chroma.Lexer {
+	if lexer := lexers.Get(language); lexer != nil {
+		return lexer
+	}
+	if lexer, _ := DetectLexer(code); lexer != nil {
+		logger.Debug().Str("language", language).Str("detected", lexer.Config().Name).Msg("No lexer found for language. Using detected lexer.")
+		return lexer
+	}
+	logger.Warn().Str("language", language).Msg("No lexer found for language. Using fallback lexer.")
+	return lexers.Fallback
+}
 
-	css = strings.ReplaceAll(css, "  ", " ")
+// LinePrefix starts the IDs of line anchors, as in #L10.
+const LinePrefix = "L"
 
-	chromaRule := regexp.MustCompile(`\.chroma\s*\{[^\}]*\}`)
-	if chromaRule.MatchString(css) {
-		css = chromaRule.ReplaceAllStringFunc(css, func(match string) string {
-			if strings.Contains(match, "white-space:") {
-				return strings.Replace(match, "white-space: nowrap;", "white-space: pre-wrap;", 1)
-			}
-			return strings.TrimSuffix(match, "}") + " white-space: pre-wrap;}"
-		})
-	} else {
-		css += "\n.chroma { white-space: pre-wrap; }"
-	}
+// LineRange is an inclusive range of 1-based line numbers.
+type LineRange struct {
+	Start int
+	End   int
+}
 
-	// Add word-wrap: break-word to .chroma class
-	if chromaRule.MatchString(css) {
-		css = chromaRule.ReplaceAllStringFunc(css, func(match string) string {
-			if !strings.Contains(match, "word-wrap:") {
-				return strings.TrimSuffix(match, "}") + " word-wrap: break-word;}"
+// maxLineRanges bounds the number of ranges ParseLineRanges returns.
+const maxLineRanges = 100
+
+// ParseLineRanges parses comma-separated lines and ranges of lines like
+// "10-20,30", also accepting the form of line anchors, "L10-L20". Invalid
+// parts are skipped. The ranges are sorted, as chroma expects.
+func ParseLineRanges(value string) []LineRange {
+	var ranges []LineRange
+	for _, part := range strings.Split(value, ",") {
+		if len(ranges) == maxLineRanges {
+			break
+		}
+		start, end, found := strings.Cut(strings.TrimSpace(part), "-")
+		first, err := strconv.Atoi(strings.TrimPrefix(start, LinePrefix))
+		if err != nil || first < 1 {
+			continue
+		}
+		last := first
+		if found {
+			last, err = strconv.Atoi(strings.TrimPrefix(end, LinePrefix))
+			if err != nil || last < 1 {
+				continue
 			}
-			return match
-		})
-	} else {
-		css += "\n.chroma { word-wrap: break-word; }"
+		}
+		if last < first {
+			first, last = last, first
+		}
+		ranges = append(ranges, LineRange{Start: first, End: last})
 	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Start < ranges[j].Start })
+	return ranges
+}
 
-	err = os.WriteFile("static/css/chroma.css", []byte(css), 0644)
-	if err != nil {
-		logger.Error().Err(err).Msg("Failed to write chroma.css")
-		return err
+// Anchor returns the URL fragment, without the "#", that selects the range
+// among line anchors whose IDs start with prefix, like L10-L20.
+func (r LineRange) Anchor(prefix string) string {
+	if r.Start == r.End {
+		return fmt.Sprintf("%s%d", prefix, r.Start)
 	}
+	return fmt.Sprintf("%s%d-%s%d", prefix, r.Start, LinePrefix, r.End)
+}
 
-	logger.Info().Msg("Generated chroma.css")
-	return nil
+// HighlightOptions changes how HighlightCodeWithOptions renders code.
+type HighlightOptions struct {
+	// LinePrefix starts the IDs of line anchors. It defaults to the
+	// package's LinePrefix and must differ between code shown on one page.
+	LinePrefix string
+	// Lines are marked as highlighted.
+	Lines []LineRange
+	// HideLineNumbers leaves out line numbers and their anchors, for code
+	// embedded in other documents.
+	HideLineNumbers bool
 }
 
+// HighlightCode renders code with line numbers that link to themselves.
 func HighlightCode(code, language string) (string, error) {
+	return HighlightCodeWithOptions(code, language, HighlightOptions{})
+}
+
+func HighlightCodeWithOptions(code, language string, options HighlightOptions) (string, error) {
 	logger.Debug().Str("language", language).Msg("Highlighting code")
-	lexer := lexers.Get(language)
-	if lexer == nil {
-		logger.Warn().Str("language", language).Msg("No lexer found for language. Using fallback lexer.")
-		lexer = lexers.Fallback
-	}
+	lexer := lexerFor(code, language)
 
 	iterator, err := lexer.Tokenise(nil, code)
 	if err != nil {
 		return "", err
 	}
 
-	style := styles.Get("tokyonight-night")
-	if style == nil {
-		logger.Warn().Msg("No style found. Using fallback style.")
-		style = styles.Fallback
-	}
+	style := chromaStyle()
 
-	formatter := html.New(html.WithClasses(true))
+	prefix := options.LinePrefix
+	if prefix == "" {
+		prefix = LinePrefix
+	}
+	lines := make([][2]int, len(options.Lines))
+	for i, r := range options.Lines {
+		lines[i] = [2]int{r.Start, r.End}
+	}
+	formatter := html.New(
+		html.WithClasses(true),
+		html.WithLineNumbers(!options.HideLineNumbers),
+		html.WithLinkableLineNumbers(!options.HideLineNumbers, prefix),
+		html.HighlightLines(lines),
+	)
 	var buf strings.Builder
 	err = formatter.Format(&buf, style, iterator)
 	if err != nil {
@@ -100,3 +194,48 @@ func HighlightCode(code, language string) (string, error) {
 
 	return buf.String(), nil
 }
+
+// LanguageExtension returns the file extension, including the dot, that the
+// chroma lexer for language registers first. It falls back to ".txt".
+func LanguageExtension(language string) string {
+	lexer := lexers.Get(language)
+	if lexer == nil {
+		return ".txt"
+	}
+	for _, glob := range lexer.Config().Filenames {
+		ext, ok := strings.CutPrefix(glob, "*")
+		if ok && strings.HasPrefix(ext, ".") && !strings.ContainsAny(ext, "*?[") {
+			return ext
+		}
+	}
+	return ".txt"
+}
+
+// HighlightLines highlights code and returns the HTML of each line on its
+// own, without the surrounding <pre>, for views that lay lines out
+// themselves. The lines match SplitLines(code).
+func HighlightLines(code, language string) ([]string, error) {
+	lexer := lexerFor(code, language)
+
+	iterator, err := lexer.Tokenise(nil, code)
+	if err != nil {
+		return nil, err
+	}
+
+	style := chromaStyle()
+
+	formatter := html.New(html.WithClasses(true), html.PreventSurroundingPre(true))
+	lines := SplitLines(code)
+	highlighted := make([]string, len(lines))
+	for i, tokens := range chroma.SplitTokensIntoLines(iterator.Tokens()) {
+		if i >= len(lines) {
+			break
+		}
+		var buf strings.Builder
+		if err := formatter.Format(&buf, style, chroma.Literator(tokens...)); err != nil {
+			return nil, err
+		}
+		highlighted[i] = strings.ReplaceAll(buf.String(), "\n", "")
+	}
+	return highlighted, nil
+}
@@ -0,0 +1,156 @@
+package util
+
+import (
+	"encoding/json"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+)
+
+var (
+	vimModeline   = regexp.MustCompile(`(?:^|\s)(?:vi|vim|ex):.*?\b(?:ft|filetype|syntax)=([\w+-]+)`)
+	emacsModeline = regexp.MustCompile(`-\*-\s*(.*?)\s*-\*-`)
+	emacsMode     = regexp.MustCompile(`(?i)(?:^|;)\s*mode:\s*([\w+-]+)`)
+	versionSuffix = regexp.MustCompile(`[\d.]+$`)
+)
+
+// interpreterLexers maps shebang interpreters to lexers where the names
+// differ.
+var interpreterLexers = map[string]string{
+	"node":   "javascript",
+	"nodejs": "javascript",
+	"bun":    "javascript",
+	"deno":   "typescript",
+	"sh":     "bash",
+	"dash":   "bash",
+	"pwsh":   "powershell",
+}
+
+// contentHints are patterns for common languages that chroma's analysers do
+// not recognise. Each match scores the named lexer.
+var contentHints = []struct {
+	pattern *regexp.Regexp
+	lexer   string
+	score   float32
+}{
+	{regexp.MustCompile(`(?m)^package \w+\s*$[\s\S]*^(?:func|import|type|var|const)\b`), "go", 0.8},
+	{regexp.MustCompile(`(?m)^\s*(?:def \w+\(.*\)\s*(?:->.*)?:\s*$|from [\w.]+ import \w|if __name__ == ['"]__main__['"]:)`), "python", 0.6},
+	{regexp.MustCompile(`(?m)^\s*(?:pub\s+)?fn \w+\s*(?:<[^>]*>)?\(|\blet mut \w|^\s*use \w+(?:::\w+)+;`), "rust", 0.6},
+	{regexp.MustCompile(`(?i)^\s*(?:<!doctype html|<html[\s>])`), "html", 0.8},
+	{regexp.MustCompile(`(?m)^FROM\s+\S+(?:\s+AS\s+\S+)?\s*$[\s\S]*^(?:RUN|COPY|CMD|ENTRYPOINT|WORKDIR)\s`), "docker", 0.7},
+	{regexp.MustCompile(`(?is)^\s*(?:SELECT\s.+?\sFROM\s|INSERT\s+INTO\s|CREATE\s+(?:TABLE|INDEX|VIEW)\s|UPDATE\s+\w+\s+SET\s|DELETE\s+FROM\s)`), "sql", 0.6},
+	{regexp.MustCompile(`(?m)^\s*(?:export\s+)?(?:interface|type)\s+\w+\s*(?:=|\{)|\b(?:const|let)\s+\w+\s*:\s*\w+`), "typescript", 0.5},
+	{regexp.MustCompile(`(?m)^\s*(?:const|let|var)\s+\w+\s*=|\bconsole\.log\(|^\s*function\s+\w+\s*\(`), "javascript", 0.4},
+	{regexp.MustCompile(`(?m)^\s*local\s+\w+\s*=|^\s*local\s+function\s`), "lua", 0.5},
+	{regexp.MustCompile(`(?m)^\s*\[[\w.-]+\]\s*$[\s\S]*^\s*[\w.-]+\s*=\s*\S`), "toml", 0.5},
+	{regexp.MustCompile(`(?m)^\s*[\w.#:\[\]="-]+(?:\s*,\s*[\w.#:\[\]="-]+)*\s*\{\s*$\s*^\s*[\w-]+\s*:\s*[^;]+;`), "css", 0.5},
+	{regexp.MustCompile(`\bmkDerivation\b|\bwith import <nixpkgs>|\{\s*(?:pkgs|lib|config)\s*,[^}]*\}:`), "nix", 0.7},
+	{regexp.MustCompile(`\A(?:---\s*\n)?(?:#.*\n)*[\w-]+:(?:[ \t]+\S.*)?\n[\w -]*\S`), "yaml", 0.3},
+	{regexp.MustCompile(`(?m)^\s*(?:if \[\[? |fi\s*$|echo \S|export \w+=)`), "bash", 0.3},
+}
+
+// DetectLexer guesses the lexer for code from a vim or emacs modeline, its
+// shebang line or, failing those, its content. The confidence is between 0
+// and 1, and the lexer is nil when nothing matched.
+func DetectLexer(code string) (chroma.Lexer, float32) {
+	if lexer := modelineLexer(code); lexer != nil {
+		return lexer, 0.95
+	}
+	if lexer := shebangLexer(code); lexer != nil {
+		return lexer, 0.9
+	}
+	return contentLexer(code)
+}
+
+// modelineLexer looks for a modeline in the first and last five lines.
+func modelineLexer(code string) chroma.Lexer {
+	lines := strings.Split(code, "\n")
+	if len(lines) > 10 {
+		lines = append(lines[:5], lines[len(lines)-5:]...)
+	}
+	for _, line := range lines {
+		if match := vimModeline.FindStringSubmatch(line); match != nil {
+			if lexer := lexers.Get(match[1]); lexer != nil {
+				return lexer
+			}
+		}
+		if match := emacsModeline.FindStringSubmatch(line); match != nil {
+			mode := match[1]
+			if m := emacsMode.FindStringSubmatch(mode); m != nil {
+				mode = m[1]
+			} else if strings.Contains(mode, ":") {
+				continue
+			}
+			if lexer := lexers.Get(strings.TrimSuffix(mode, "-mode")); lexer != nil {
+				return lexer
+			}
+		}
+	}
+	return nil
+}
+
+// shebangLexer picks the lexer of the interpreter named by a #! line,
+// looking through env and ignoring version suffixes like python3.12.
+func shebangLexer(code string) chroma.Lexer {
+	line, _, _ := strings.Cut(code, "\n")
+	command, ok := strings.CutPrefix(line, "#!")
+	if !ok {
+		return nil
+	}
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil
+	}
+	interpreter := path.Base(fields[0])
+	if interpreter == "env" {
+		interpreter = ""
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "-") && !strings.Contains(field, "=") {
+				interpreter = path.Base(field)
+				break
+			}
+		}
+	}
+	interpreter = versionSuffix.ReplaceAllString(interpreter, "")
+	if name, ok := interpreterLexers[interpreter]; ok {
+		interpreter = name
+	}
+	if interpreter == "" {
+		return nil
+	}
+	return lexers.Get(interpreter)
+}
+
+// contentLexer scores the content with every chroma analyser and the
+// content hints, returning the best match.
+func contentLexer(code string) (chroma.Lexer, float32) {
+	trimmed := strings.TrimSpace(code)
+	if trimmed == "" {
+		return nil, 0
+	}
+	if (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid([]byte(trimmed)) {
+		return lexers.Get("json"), 0.9
+	}
+
+	var best chroma.Lexer
+	var bestScore float32
+	for _, lexer := range lexers.GlobalLexerRegistry.Lexers {
+		if score := lexer.AnalyseText(code); score > bestScore {
+			best, bestScore = lexer, score
+		}
+	}
+	for _, hint := range contentHints {
+		if hint.score > bestScore && hint.pattern.MatchString(code) {
+			if lexer := lexers.Get(hint.lexer); lexer != nil {
+				best, bestScore = lexer, hint.score
+			}
+		}
+	}
+	if bestScore > 1 {
+		bestScore = 1
+	}
+	return best, bestScore
+}
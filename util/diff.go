@@ -0,0 +1,306 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+)
+
+type DiffKind int
+
+const (
+	DiffEqual DiffKind = iota
+	DiffDelete
+	DiffInsert
+)
+
+// DiffLine is one line of a line-based diff. OldNumber and NewNumber are the
+// 1-based line numbers in the old and new text, or 0 when the line does not
+// exist on that side. HTML is left for the caller to fill in.
+type DiffLine struct {
+	Kind      DiffKind
+	OldNumber int
+	NewNumber int
+	Text      string
+	HTML      string
+}
+
+// DiffPair is a row of a side-by-side diff. Deleted and inserted lines next
+// to each other are paired up; either side is nil when there is no line.
+type DiffPair struct {
+	Old *DiffLine
+	New *DiffLine
+}
+
+// maxDiffEdits bounds the work done by DiffLines. Myers' algorithm keeps a
+// trace of about maxDiffEdits² ints to recover the edits, 2 MB at 500, so
+// texts that differ by more lines than that are diffed as a whole block
+// replacement.
+const maxDiffEdits = 500
+
+// SplitLines splits text into lines, ignoring a single trailing newline.
+func SplitLines(text string) []string {
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// DiffLines computes a line diff of two texts using Myers' algorithm.
+func DiffLines(oldText, newText string) []DiffLine {
+	a, b := SplitLines(oldText), SplitLines(newText)
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var lines []DiffLine
+	for i := 0; i < prefix; i++ {
+		lines = append(lines, DiffLine{Kind: DiffEqual, OldNumber: i + 1, NewNumber: i + 1, Text: a[i]})
+	}
+
+	middle := myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])
+	for _, line := range middle {
+		if line.OldNumber > 0 {
+			line.OldNumber += prefix
+		}
+		if line.NewNumber > 0 {
+			line.NewNumber += prefix
+		}
+		lines = append(lines, line)
+	}
+
+	for i := suffix; i > 0; i-- {
+		lines = append(lines, DiffLine{Kind: DiffEqual, OldNumber: len(a) - i + 1, NewNumber: len(b) - i + 1, Text: a[len(a)-i]})
+	}
+	return lines
+}
+
+// myers returns the shortest edit script between a and b with line numbers
+// relative to the given slices.
+func myers(a, b []string) []DiffLine {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return replaceAll(a, b)
+	}
+
+	offset := n + m
+	v := make([]int, 2*offset+2)
+	var trace [][]int
+	found := false
+	for d := 0; d <= n+m && d <= maxDiffEdits; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+		if found {
+			break
+		}
+	}
+	if !found {
+		return replaceAll(a, b)
+	}
+
+	var reversed []DiffLine
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		// trace[d] holds the endpoints reached after d-1 edits, stored from
+		// diagonal -d onwards.
+		prev := trace[d]
+		at := func(k int) int { return prev[k+d] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			reversed = append(reversed, DiffLine{Kind: DiffEqual, OldNumber: x, NewNumber: y, Text: a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			reversed = append(reversed, DiffLine{Kind: DiffInsert, NewNumber: y, Text: b[y-1]})
+		} else {
+			reversed = append(reversed, DiffLine{Kind: DiffDelete, OldNumber: x, Text: a[x-1]})
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 && y > 0 {
+		reversed = append(reversed, DiffLine{Kind: DiffEqual, OldNumber: x, NewNumber: y, Text: a[x-1]})
+		x--
+		y--
+	}
+
+	lines := make([]DiffLine, len(reversed))
+	for i, line := range reversed {
+		lines[len(reversed)-1-i] = line
+	}
+	return lines
+}
+
+func replaceAll(a, b []string) []DiffLine {
+	var lines []DiffLine
+	for i, text := range a {
+		lines = append(lines, DiffLine{Kind: DiffDelete, OldNumber: i + 1, Text: text})
+	}
+	for i, text := range b {
+		lines = append(lines, DiffLine{Kind: DiffInsert, NewNumber: i + 1, Text: text})
+	}
+	return lines
+}
+
+// SplitDiff arranges a diff for side-by-side display.
+func SplitDiff(lines []DiffLine) []DiffPair {
+	var pairs []DiffPair
+	for i := 0; i < len(lines); {
+		if lines[i].Kind == DiffEqual {
+			pairs = append(pairs, DiffPair{Old: &lines[i], New: &lines[i]})
+			i++
+			continue
+		}
+		var deleted, inserted []*DiffLine
+		for ; i < len(lines) && lines[i].Kind != DiffEqual; i++ {
+			if lines[i].Kind == DiffDelete {
+				deleted = append(deleted, &lines[i])
+			} else {
+				inserted = append(inserted, &lines[i])
+			}
+		}
+		for j := 0; j < len(deleted) || j < len(inserted); j++ {
+			var pair DiffPair
+			if j < len(deleted) {
+				pair.Old = deleted[j]
+			}
+			if j < len(inserted) {
+				pair.New = inserted[j]
+			}
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs
+}
+
+// HasChanges reports whether a diff contains any inserted or deleted line.
+func HasChanges(lines []DiffLine) bool {
+	for _, line := range lines {
+		if line.Kind != DiffEqual {
+			return true
+		}
+	}
+	return false
+}
+
+// UnifiedDiff formats a diff in the unified format read by patch and git
+// apply, with the given number of context lines around each change.
+func UnifiedDiff(oldName, newName string, lines []DiffLine, context int) string {
+	if !HasChanges(lines) {
+		return ""
+	}
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", oldName, newName)
+
+	for start := 0; start < len(lines); {
+		// Find the next change and the extent of its hunk.
+		first := start
+		for first < len(lines) && lines[first].Kind == DiffEqual {
+			first++
+		}
+		if first == len(lines) {
+			break
+		}
+		hunkStart := max(first-context, start)
+		hunkEnd := first
+		for i := first; i < len(lines); i++ {
+			if lines[i].Kind != DiffEqual {
+				hunkEnd = i + 1
+			} else if i-hunkEnd >= 2*context {
+				break
+			}
+		}
+		hunkEnd = min(hunkEnd+context, len(lines))
+
+		oldStart, newStart, oldCount, newCount := 0, 0, 0, 0
+		for _, line := range lines[hunkStart:hunkEnd] {
+			if line.Kind != DiffInsert {
+				if oldCount == 0 {
+					oldStart = line.OldNumber
+				}
+				oldCount++
+			}
+			if line.Kind != DiffDelete {
+				if newCount == 0 {
+					newStart = line.NewNumber
+				}
+				newCount++
+			}
+		}
+		if oldCount == 0 {
+			oldStart = lineBefore(lines, hunkStart, true)
+		}
+		if newCount == 0 {
+			newStart = lineBefore(lines, hunkStart, false)
+		}
+
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+		for _, line := range lines[hunkStart:hunkEnd] {
+			switch line.Kind {
+			case DiffEqual:
+				buf.WriteByte(' ')
+			case DiffDelete:
+				buf.WriteByte('-')
+			case DiffInsert:
+				buf.WriteByte('+')
+			}
+			buf.WriteString(line.Text)
+			buf.WriteByte('\n')
+		}
+		start = hunkEnd
+	}
+	return buf.String()
+}
+
+// lineBefore returns the number of the last old or new line before index i,
+// which is where an empty side of a hunk starts.
+func lineBefore(lines []DiffLine, i int, old bool) int {
+	for j := i - 1; j >= 0; j-- {
+		if old && lines[j].OldNumber > 0 {
+			return lines[j].OldNumber
+		}
+		if !old && lines[j].NewNumber > 0 {
+			return lines[j].NewNumber
+		}
+	}
+	return 0
+}
+
+func hunkRange(start, count int) string {
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
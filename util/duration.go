@@ -0,0 +1,104 @@
+package util
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Day  = 24 * time.Hour
+	Week = 7 * Day
+)
+
+var (
+	durationPart = regexp.MustCompile(`(\d+(?:\.\d+)?)(ns|us|µs|ms|s|m|h|d|w)`)
+	isoDuration  = regexp.MustCompile(`^P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+)
+
+// ParseDuration parses Go duration strings extended with day and week units
+// ("30m", "7d", "2w", "1d12h") as well as ISO-8601 durations ("PT30M",
+// "P7D", "P2W"). ISO years and months count as 365 and 30 days.
+func ParseDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+	if value[0] == 'P' || value[0] == 'p' {
+		return parseISODuration(strings.ToUpper(value))
+	}
+
+	matches := durationPart.FindAllStringSubmatch(value, -1)
+	consumed := 0
+	var total time.Duration
+	for _, match := range matches {
+		consumed += len(match[0])
+		number, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			return 0, err
+		}
+		switch match[2] {
+		case "d":
+			total += time.Duration(number * float64(Day))
+		case "w":
+			total += time.Duration(number * float64(Week))
+		default:
+			d, err := time.ParseDuration(match[0])
+			if err != nil {
+				return 0, err
+			}
+			total += d
+		}
+	}
+	if len(matches) == 0 || consumed != len(value) {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return total, nil
+}
+
+func parseISODuration(value string) (time.Duration, error) {
+	match := isoDuration.FindStringSubmatch(value)
+	if match == nil || value == "P" || strings.HasSuffix(value, "T") {
+		return 0, fmt.Errorf("invalid ISO-8601 duration %q", value)
+	}
+	units := []time.Duration{365 * Day, 30 * Day, Week, Day, time.Hour, time.Minute, time.Second}
+	var total time.Duration
+	for i, unit := range units {
+		if match[i+1] == "" {
+			continue
+		}
+		number, err := strconv.ParseFloat(match[i+1], 64)
+		if err != nil {
+			return 0, err
+		}
+		total += time.Duration(number * float64(unit))
+	}
+	return total, nil
+}
+
+// FormatDuration renders a duration in the largest whole unit, e.g. "2 Weeks"
+// or "90 Minutes".
+func FormatDuration(d time.Duration) string {
+	units := []struct {
+		size time.Duration
+		name string
+	}{
+		{Week, "Week"},
+		{Day, "Day"},
+		{time.Hour, "Hour"},
+		{time.Minute, "Minute"},
+		{time.Second, "Second"},
+	}
+	for _, unit := range units {
+		if d >= unit.size && d%unit.size == 0 {
+			count := int64(d / unit.size)
+			if count == 1 {
+				return "One " + unit.name
+			}
+			return fmt.Sprintf("%d %ss", count, unit.name)
+		}
+	}
+	return d.String()
+}
@@ -0,0 +1,346 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters/svg"
+	"github.com/alecthomas/chroma/v2/styles"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/gomonobolditalic"
+	"golang.org/x/image/font/gofont/gomonoitalic"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Bounds of the options of snippet images.
+const (
+	DefaultImageFontSize = 14
+	MinImageFontSize     = 8
+	MaxImageFontSize     = 32
+	DefaultImagePadding  = 32
+	MaxImagePadding      = 128
+)
+
+// Longer snippets are cut off, which also bounds the memory a PNG takes.
+const (
+	maxImageLines   = 200
+	maxImageColumns = 160
+	maxImagePixels  = 16 << 20
+)
+
+// imageLineHeight is the line height in ems, the one chroma's SVG formatter
+// uses.
+const imageLineHeight = 1.2
+
+// ImageOptions configure an image of highlighted code.
+type ImageOptions struct {
+	// Theme is a chroma style. ThemeAuto uses the dark theme.
+	Theme string
+	// FontSize is in pixels.
+	FontSize float64
+	// Padding surrounds the code, in pixels.
+	Padding     int
+	LineNumbers bool
+	// Width and Height fix the size of the image, in pixels, cropping the
+	// code to fit, instead of fitting the image to the code.
+	Width  int
+	Height int
+}
+
+// DefaultImageOptions returns the options of an image that no one has
+// asked anything of.
+func DefaultImageOptions() ImageOptions {
+	return ImageOptions{
+		Theme:       ThemeAuto,
+		FontSize:    DefaultImageFontSize,
+		Padding:     DefaultImagePadding,
+		LineNumbers: true,
+	}
+}
+
+// The size of OpenGraph preview images that most sites display uncropped.
+const (
+	PreviewWidth  = 1200
+	PreviewHeight = 630
+)
+
+// PreviewImageOptions returns the options of the OpenGraph preview image of
+// a snippet, which shows as much of its start as fits.
+func PreviewImageOptions(theme string) ImageOptions {
+	return ImageOptions{
+		Theme:       theme,
+		FontSize:    24,
+		Padding:     48,
+		LineNumbers: true,
+		Width:       PreviewWidth,
+		Height:      PreviewHeight,
+	}
+}
+
+// imageLayout is code split into lines of tokens, with line numbers added,
+// and the size of the image that shows it.
+type imageLayout struct {
+	lines     [][]chroma.Token
+	style     *chroma.Style
+	fontSize  float64
+	charWidth float64
+	padding   int
+	width     int
+	height    int
+}
+
+// layoutImage tokenises code and decides the size of its image. charWidth
+// is the advance of the font, as a fraction of the font size.
+func layoutImage(code, language string, options ImageOptions, charWidth float64) (*imageLayout, error) {
+	fontSize := math.Max(MinImageFontSize, math.Min(MaxImageFontSize, options.FontSize))
+	padding := max(0, min(MaxImagePadding, options.Padding))
+	layout := &imageLayout{
+		style:     styles.Get(TerminalTheme(options.Theme)),
+		fontSize:  fontSize,
+		charWidth: charWidth * fontSize,
+		padding:   padding,
+	}
+
+	iterator, err := lexerFor(code, language).Tokenise(nil, code)
+	if err != nil {
+		return nil, err
+	}
+	lines := chroma.SplitTokensIntoLines(iterator.Tokens())
+	if len(lines) > maxImageLines {
+		lines = lines[:maxImageLines]
+	}
+	numberWidth := len(fmt.Sprint(len(lines)))
+
+	columns := 0
+	for i, tokens := range lines {
+		line := clipTokens(tokens, maxImageColumns)
+		if options.LineNumbers {
+			number := chroma.Token{Type: chroma.LineNumbers, Value: fmt.Sprintf("%*d  ", numberWidth, i+1)}
+			line = append([]chroma.Token{number}, line...)
+		}
+		columns = max(columns, tokensWidth(line))
+		lines[i] = line
+	}
+
+	lineHeight := imageLineHeight * fontSize
+	layout.width = options.Width
+	if layout.width <= 0 {
+		layout.width = 2*padding + int(math.Ceil(float64(columns)*layout.charWidth))
+	}
+	fit := (maxImagePixels/max(layout.width, 1) - 2*padding) / int(math.Ceil(lineHeight))
+	if options.Height > 0 {
+		fit = (options.Height - 2*padding) / int(math.Ceil(lineHeight))
+	}
+	if len(lines) > fit {
+		lines = lines[:max(fit, 0)]
+	}
+	layout.lines = lines
+	layout.height = options.Height
+	if layout.height <= 0 {
+		layout.height = 2*padding + int(math.Ceil(float64(len(lines))*lineHeight+0.3*fontSize))
+	}
+	layout.width, layout.height = max(layout.width, 1), max(layout.height, 1)
+	if layout.width*layout.height > maxImagePixels {
+		return nil, fmt.Errorf("image of %dx%d pixels is too large", layout.width, layout.height)
+	}
+	return layout, nil
+}
+
+// clipTokens expands tabs and cuts a line off after columns characters,
+// ending it with a newline as chroma's formatters expect.
+func clipTokens(tokens []chroma.Token, columns int) []chroma.Token {
+	var line []chroma.Token
+	width := 0
+	for _, token := range tokens {
+		value := strings.TrimRight(strings.ReplaceAll(token.Value, "\t", "    "), "\r\n")
+		if n := utf8.RuneCountInString(value); width+n > columns {
+			value = string([]rune(value)[:columns-width])
+		}
+		width += utf8.RuneCountInString(value)
+		if value != "" {
+			line = append(line, chroma.Token{Type: token.Type, Value: value})
+		}
+		if width >= columns {
+			break
+		}
+	}
+	return append(line, chroma.Token{Type: chroma.Text, Value: "\n"})
+}
+
+func tokensWidth(tokens []chroma.Token) int {
+	width := 0
+	for _, token := range tokens {
+		width += utf8.RuneCountInString(strings.TrimSuffix(token.Value, "\n"))
+	}
+	return width
+}
+
+func (l *imageLayout) background() chroma.Colour {
+	if bg := l.style.Get(chroma.Background).Background; bg.IsSet() {
+		return bg
+	}
+	return chroma.MustParseColour("#ffffff")
+}
+
+// svgRoot matches the root element written by chroma's SVG formatter.
+var svgRoot = regexp.MustCompile(`<svg width="\d+px" height="\d+px"`)
+
+// RenderSVG renders code highlighted by chroma's SVG formatter. The
+// formatter always uses 14px text, so it is scaled to the font size and
+// framed by the padding.
+func RenderSVG(code, language string, options ImageOptions) ([]byte, error) {
+	layout, err := layoutImage(code, language, options, 0.6)
+	if err != nil {
+		return nil, err
+	}
+	var tokens []chroma.Token
+	for _, line := range layout.lines {
+		tokens = append(tokens, line...)
+	}
+	var inner bytes.Buffer
+	if err := svg.New().Format(&inner, layout.style, chroma.Literator(tokens...)); err != nil {
+		return nil, err
+	}
+	content := inner.String()
+	start := svgRoot.FindStringIndex(content)
+	if start == nil {
+		return nil, fmt.Errorf("unexpected output of the SVG formatter")
+	}
+	// Chroma sizes the text at 8px a character, which is a little narrow
+	// for most monospace fonts.
+	content = `<svg overflow="visible"` + content[start[0]+len("<svg"):]
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\">\n", layout.width, layout.height, layout.width, layout.height)
+	fmt.Fprintf(&buf, "<rect width=\"100%%\" height=\"100%%\" fill=\"%s\"/>\n", layout.background())
+	fmt.Fprintf(&buf, "<g transform=\"translate(%d %d) scale(%g)\">\n", layout.padding, layout.padding, layout.fontSize/DefaultImageFontSize)
+	buf.WriteString(content)
+	buf.WriteString("</g>\n</svg>\n")
+	return buf.Bytes(), nil
+}
+
+// imageFonts are the Go Mono faces PNGs are drawn with, parsed once.
+var imageFonts = sync.OnceValues(func() (map[string]*opentype.Font, error) {
+	fonts := map[string]*opentype.Font{}
+	for name, data := range map[string][]byte{
+		"regular":     gomono.TTF,
+		"bold":        gomonobold.TTF,
+		"italic":      gomonoitalic.TTF,
+		"bold-italic": gomonobolditalic.TTF,
+	} {
+		f, err := opentype.Parse(data)
+		if err != nil {
+			return nil, err
+		}
+		fonts[name] = f
+	}
+	return fonts, nil
+})
+
+// RenderPNG draws code the way RenderSVG lays it out, with Go Mono, as a
+// PNG.
+func RenderPNG(code, language string, options ImageOptions) ([]byte, error) {
+	fonts, err := imageFonts()
+	if err != nil {
+		return nil, err
+	}
+	// Go Mono advances 0.6em a character.
+	layout, err := layoutImage(code, language, options, 0.6)
+	if err != nil {
+		return nil, err
+	}
+
+	faces := map[string]font.Face{}
+	for name, f := range fonts {
+		face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: layout.fontSize, DPI: 72, Hinting: font.HintingNone})
+		if err != nil {
+			return nil, err
+		}
+		defer face.Close()
+		faces[name] = face
+	}
+
+	background := layout.background()
+	img := image.NewRGBA(image.Rect(0, 0, layout.width, layout.height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(rgba(background)), image.Point{}, draw.Src)
+
+	text := layout.style.Get(chroma.Text).Colour
+	if !text.IsSet() {
+		text = chroma.MustParseColour("#000000")
+		if background.Brightness() < 0.5 {
+			text = chroma.MustParseColour("#ffffff")
+		}
+	}
+	lineHeight := imageLineHeight * layout.fontSize
+	metrics := faces["regular"].Metrics()
+	ascent := float64(metrics.Ascent) / 64
+	descent := float64(metrics.Descent) / 64
+	for i, line := range layout.lines {
+		top := float64(layout.padding) + float64(i)*lineHeight
+		baseline := top + (lineHeight+ascent-descent)/2
+		x := float64(layout.padding)
+		for _, token := range line {
+			value := strings.TrimSuffix(token.Value, "\n")
+			if value == "" {
+				continue
+			}
+			entry := layout.style.Get(token.Type)
+			width := float64(utf8.RuneCountInString(value)) * layout.charWidth
+			if entry.Background.IsSet() && entry.Background != background {
+				rect := image.Rect(int(x), int(top), int(math.Ceil(x+width)), int(math.Ceil(top+lineHeight)))
+				draw.Draw(img, rect, image.NewUniform(rgba(entry.Background)), image.Point{}, draw.Src)
+			}
+			colour := entry.Colour
+			if !colour.IsSet() {
+				colour = text
+			}
+			drawer := font.Drawer{
+				Dst:  img,
+				Src:  image.NewUniform(rgba(colour)),
+				Face: faces[faceName(entry)],
+				Dot:  fixed.Point26_6{X: fixed.Int26_6(x * 64), Y: fixed.Int26_6(baseline * 64)},
+			}
+			drawer.DrawString(value)
+			if entry.Underline == chroma.Yes {
+				underline := image.Rect(int(x), int(baseline)+1, int(math.Ceil(x+width)), int(baseline)+2)
+				draw.Draw(img, underline, image.NewUniform(rgba(colour)), image.Point{}, draw.Src)
+			}
+			x += width
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func faceName(entry chroma.StyleEntry) string {
+	switch {
+	case entry.Bold == chroma.Yes && entry.Italic == chroma.Yes:
+		return "bold-italic"
+	case entry.Bold == chroma.Yes:
+		return "bold"
+	case entry.Italic == chroma.Yes:
+		return "italic"
+	}
+	return "regular"
+}
+
+func rgba(c chroma.Colour) color.RGBA {
+	return color.RGBA{R: c.Red(), G: c.Green(), B: c.Blue(), A: 0xff}
+}
@@ -0,0 +1,115 @@
+package util
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	gmutil "github.com/yuin/goldmark/util"
+)
+
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM, codeBlocks{}),
+	goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+)
+
+// RenderMarkdown renders GitHub-flavored Markdown to sanitized HTML. Raw
+// HTML in the source is dropped and fenced code blocks are highlighted like
+// snippets, without line numbers.
+func RenderMarkdown(source string) (string, error) {
+	var buf bytes.Buffer
+	if err := convertMarkdown([]byte(source), &buf, newHeadingIDs()); err != nil {
+		return "", err
+	}
+	return SanitizeHTML(buf.String()), nil
+}
+
+// headingIDPrefix starts the IDs of headings, as on GitHub, so that a
+// heading cannot take the ID of an element of the page around the document.
+const headingIDPrefix = "user-content-"
+
+// headingIDs generates the IDs of headings like goldmark does, prefixed by
+// headingIDPrefix.
+type headingIDs struct {
+	parser.IDs
+}
+
+func newHeadingIDs() parser.IDs {
+	return headingIDs{parser.NewContext().IDs()}
+}
+
+func (ids headingIDs) Generate(value []byte, kind ast.NodeKind) []byte {
+	return append([]byte(headingIDPrefix), ids.IDs.Generate(value, kind)...)
+}
+
+// convertMarkdown renders source with ids, which documents made of several
+// Markdown sources share to keep their heading IDs unique.
+func convertMarkdown(source []byte, w io.Writer, ids parser.IDs) error {
+	return markdown.Convert(source, w, parser.WithContext(parser.NewContext(parser.WithIDs(ids))))
+}
+
+var (
+	documentClass = regexp.MustCompile(`^[A-Za-z0-9 _-]+$`)
+	headingID     = regexp.MustCompile(`^` + headingIDPrefix + `[A-Za-z0-9_-]+$`)
+)
+
+// documentPolicy allows what rendered documents need on top of user
+// generated content: chroma's classes, heading anchors, task list
+// checkboxes and inline images of notebook outputs.
+var documentPolicy = sync.OnceValue(func() *bluemonday.Policy {
+	policy := bluemonday.UGCPolicy()
+	policy.AllowAttrs("class").Matching(documentClass).OnElements("div", "p", "pre", "code", "span", "a")
+	policy.AllowAttrs("id").Matching(headingID).OnElements("h1", "h2", "h3", "h4", "h5", "h6")
+	policy.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	policy.AllowAttrs("checked", "disabled").OnElements("input")
+	policy.AllowDataURIImages()
+	policy.RequireNoFollowOnLinks(true)
+	policy.AddTargetBlankToFullyQualifiedLinks(true)
+	return policy
+})
+
+// SanitizeHTML strips everything from rendered documents that is not plain
+// formatting, such as scripts, styles, event handlers and javascript: URLs.
+func SanitizeHTML(html string) string {
+	return documentPolicy().Sanitize(html)
+}
+
+// codeBlocks highlights fenced code blocks with chroma.
+type codeBlocks struct{}
+
+func (codeBlocks) Extend(m goldmark.Markdown) {
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(gmutil.Prioritized(codeBlocks{}, 100)))
+}
+
+func (codeBlocks) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindFencedCodeBlock, renderFencedCodeBlock)
+}
+
+func renderFencedCodeBlock(w gmutil.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	block := node.(*ast.FencedCodeBlock)
+	var code strings.Builder
+	lines := block.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		code.Write(segment.Value(source))
+	}
+	html, err := HighlightCodeWithOptions(code.String(), string(block.Language(source)), HighlightOptions{HideLineNumbers: true})
+	if err != nil {
+		return ast.WalkStop, err
+	}
+	if _, err := w.WriteString(html); err != nil {
+		return ast.WalkStop, err
+	}
+	return ast.WalkSkipChildren, nil
+}
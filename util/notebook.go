@@ -0,0 +1,166 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark/parser"
+)
+
+// notebook is the subset of the Jupyter notebook format (nbformat 4) that is
+// rendered.
+type notebook struct {
+	NBFormat int `json:"nbformat"`
+	Metadata struct {
+		LanguageInfo struct {
+			Name string `json:"name"`
+		} `json:"language_info"`
+		KernelSpec struct {
+			Language string `json:"language"`
+		} `json:"kernelspec"`
+	} `json:"metadata"`
+	Cells []notebookCell `json:"cells"`
+}
+
+type notebookCell struct {
+	CellType string           `json:"cell_type"`
+	Source   notebookText     `json:"source"`
+	Outputs  []notebookOutput `json:"outputs"`
+}
+
+type notebookOutput struct {
+	OutputType string                  `json:"output_type"`
+	Text       notebookText            `json:"text"`
+	Data       map[string]notebookText `json:"data"`
+	EName      string                  `json:"ename"`
+	EValue     string                  `json:"evalue"`
+	Traceback  []string                `json:"traceback"`
+}
+
+// notebookText is multiline text, which notebooks store either as a string
+// or as a list of lines.
+type notebookText string
+
+func (t *notebookText) UnmarshalJSON(data []byte) error {
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err == nil {
+		*t = notebookText(strings.Join(lines, ""))
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	*t = notebookText(text)
+	return nil
+}
+
+func parseNotebook(text string) (*notebook, error) {
+	var nb notebook
+	if err := json.Unmarshal([]byte(text), &nb); err != nil {
+		return nil, err
+	}
+	if nb.NBFormat < 4 {
+		return nil, fmt.Errorf("unsupported notebook format %d", nb.NBFormat)
+	}
+	return &nb, nil
+}
+
+// IsNotebook reports whether text is a Jupyter notebook.
+func IsNotebook(text string) bool {
+	if !strings.HasPrefix(strings.TrimSpace(text), "{") {
+		return false
+	}
+	_, err := parseNotebook(text)
+	return err == nil
+}
+
+// ansiEscape matches the terminal colors of tracebacks.
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+
+// RenderNotebook renders a Jupyter notebook to sanitized HTML. Markdown cells
+// are rendered like RenderMarkdown, code cells are highlighted in the
+// language of the kernel and followed by their text, image and error
+// outputs.
+func RenderNotebook(text string) (string, error) {
+	nb, err := parseNotebook(text)
+	if err != nil {
+		return "", err
+	}
+	language := nb.Metadata.LanguageInfo.Name
+	if language == "" {
+		language = nb.Metadata.KernelSpec.Language
+	}
+	if language == "" {
+		language = "python"
+	}
+
+	var buf strings.Builder
+	ids := newHeadingIDs()
+	for _, cell := range nb.Cells {
+		fmt.Fprintf(&buf, "<div class=\"notebook-cell notebook-%s\">\n", cellClass(cell.CellType))
+		switch cell.CellType {
+		case "markdown":
+			if err := convertMarkdown([]byte(cell.Source), &buf, ids); err != nil {
+				return "", err
+			}
+		case "code":
+			code, err := HighlightCodeWithOptions(string(cell.Source), language, HighlightOptions{HideLineNumbers: true})
+			if err != nil {
+				return "", err
+			}
+			buf.WriteString(code)
+			for _, output := range cell.Outputs {
+				renderOutput(&buf, output, ids)
+			}
+		default:
+			fmt.Fprintf(&buf, "<pre>%s</pre>\n", html.EscapeString(string(cell.Source)))
+		}
+		buf.WriteString("</div>\n")
+	}
+	return SanitizeHTML(buf.String()), nil
+}
+
+func cellClass(cellType string) string {
+	switch cellType {
+	case "markdown", "code":
+		return cellType
+	}
+	return "raw"
+}
+
+// renderOutput writes the richest output that is safe to show: an image,
+// Markdown or plain text. HTML outputs are left out since they usually
+// depend on scripts and styles that are stripped anyway.
+func renderOutput(buf *strings.Builder, output notebookOutput, ids parser.IDs) {
+	switch output.OutputType {
+	case "stream":
+		fmt.Fprintf(buf, "<pre class=\"notebook-output\">%s</pre>\n", html.EscapeString(string(output.Text)))
+	case "execute_result", "display_data":
+		for _, mimeType := range []string{"image/png", "image/jpeg", "image/gif"} {
+			if data, ok := output.Data[mimeType]; ok {
+				image := strings.Join(strings.Fields(string(data)), "")
+				fmt.Fprintf(buf, "<p class=\"notebook-output\"><img src=\"data:%s;base64,%s\" alt=\"\"></p>\n", mimeType, html.EscapeString(image))
+				return
+			}
+		}
+		if data, ok := output.Data["text/markdown"]; ok {
+			buf.WriteString("<div class=\"notebook-output\">\n")
+			convertMarkdown([]byte(data), buf, ids)
+			buf.WriteString("</div>\n")
+			return
+		}
+		if data, ok := output.Data["text/plain"]; ok {
+			fmt.Fprintf(buf, "<pre class=\"notebook-output\">%s</pre>\n", html.EscapeString(string(data)))
+		}
+	case "error":
+		traceback := ansiEscape.ReplaceAllString(strings.Join(output.Traceback, "\n"), "")
+		if traceback == "" {
+			traceback = output.EName + ": " + output.EValue
+		}
+		fmt.Fprintf(buf, "<pre class=\"notebook-output notebook-error\">%s</pre>\n", html.EscapeString(traceback))
+	}
+}
@@ -0,0 +1,55 @@
+package util
+
+import (
+	"strings"
+
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// Terminal color depths, named after the chroma formatters for them.
+const (
+	Terminal16        = "terminal16"
+	Terminal256       = "terminal256"
+	TerminalTrueColor = "terminal16m"
+)
+
+// ParseTerminalColors returns the terminal formatter for a color depth given
+// as "16", "256", "truecolor" or "24bit", or a formatter name.
+func ParseTerminalColors(value string) (string, bool) {
+	switch strings.ToLower(value) {
+	case "16", "8", Terminal16:
+		return Terminal16, true
+	case "256", Terminal256:
+		return Terminal256, true
+	case "truecolor", "24bit", "16m", TerminalTrueColor:
+		return TerminalTrueColor, true
+	}
+	return "", false
+}
+
+// TerminalTheme returns the theme to highlight terminal output with.
+// ThemeAuto cannot follow the terminal, so it uses the dark theme.
+func TerminalTheme(theme string) string {
+	if theme == "" || theme == ThemeAuto || !IsValidTheme(theme) {
+		return DarkTheme()
+	}
+	return theme
+}
+
+// HighlightTerminal highlights code with ANSI escape codes for a terminal
+// with the color depth of formatter, such as Terminal256.
+func HighlightTerminal(code, language, formatter, theme string) (string, error) {
+	lexer := lexerFor(code, language)
+
+	iterator, err := lexer.Tokenise(nil, code)
+	if err != nil {
+		return "", err
+	}
+
+	var buf strings.Builder
+	if err := formatters.Get(formatter).Format(&buf, styles.Get(TerminalTheme(theme)), iterator); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,189 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// ThemeAuto switches between the light and dark themes with the
+// prefers-color-scheme of the browser.
+const ThemeAuto = "auto"
+
+const (
+	defaultLightTheme = "tokyonight-day"
+	defaultDarkTheme  = "tokyonight-night"
+)
+
+// LightTheme is the theme ThemeAuto uses for a light color scheme. It is
+// configured through LIGHT_THEME.
+func LightTheme() string {
+	return themeFromEnv("LIGHT_THEME", defaultLightTheme)
+}
+
+// DarkTheme is the theme ThemeAuto uses for a dark color scheme. It is
+// configured through DARK_THEME.
+func DarkTheme() string {
+	return themeFromEnv("DARK_THEME", defaultDarkTheme)
+}
+
+func themeFromEnv(key, fallback string) string {
+	name := os.Getenv(key)
+	if name == "" {
+		return fallback
+	}
+	if styles.Registry[name] == nil {
+		logger.Warn().Str(key, name).Msg("Unknown theme. Using default.")
+		return fallback
+	}
+	return name
+}
+
+// Themes returns the themes chroma.css is generated for. They are configured
+// as a comma-separated list through THEMES and always include the light and
+// dark themes.
+func Themes() []string {
+	themes := []string{DarkTheme(), LightTheme()}
+	for _, name := range strings.Split(os.Getenv("THEMES"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || name == ThemeAuto {
+			continue
+		}
+		if styles.Registry[name] == nil {
+			logger.Warn().Str("theme", name).Msg("Unknown theme in THEMES. Skipping.")
+			continue
+		}
+		themes = append(themes, name)
+	}
+	return dedupe(themes)
+}
+
+func dedupe(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var out []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			out = append(out, value)
+		}
+	}
+	return out
+}
+
+// ThemeNames returns ThemeAuto followed by the name of every chroma style.
+func ThemeNames() []string {
+	return append([]string{ThemeAuto}, styles.Names()...)
+}
+
+// IsValidTheme reports whether name is ThemeAuto or a chroma style.
+func IsValidTheme(name string) bool {
+	return name == ThemeAuto || styles.Registry[name] != nil
+}
+
+// IsDarkTheme reports whether a theme has a dark background. ThemeAuto
+// counts as dark, which is how pages look until the browser says otherwise.
+func IsDarkTheme(name string) bool {
+	if name == ThemeAuto {
+		return true
+	}
+	style := styles.Get(name)
+	background := style.Get(chroma.Background).Background
+	return background.IsSet() && background.Brightness() < 0.5
+}
+
+// ThemeCSS returns the CSS of a single theme, scoped to elements inside
+// [data-theme="<name>"].
+func ThemeCSS(name string) string {
+	var buf strings.Builder
+	writeRules(&buf, themeRules(styles.Get(name), themeScope(name)), "")
+	return buf.String()
+}
+
+func themeScope(name string) string {
+	return fmt.Sprintf("[data-theme=%q]", name)
+}
+
+// cssRule is a CSS selector and its declarations.
+type cssRule struct {
+	selector     string
+	declarations []string
+}
+
+func writeRules(buf *strings.Builder, rules []cssRule, indent string) {
+	for _, rule := range rules {
+		fmt.Fprintf(buf, "%s%s { %s; }\n", indent, rule.selector, strings.Join(rule.declarations, "; "))
+	}
+}
+
+// baseRules lay out highlighted code the same way in every theme. Lines wrap
+// next to their line number, which is left out of copied text.
+var baseRules = []cssRule{
+	{".chroma", []string{"white-space: pre-wrap", "word-wrap: break-word"}},
+	{".chroma .line", []string{"display: flex"}},
+	{".chroma .cl", []string{"flex: 1", "min-width: 0"}},
+	{".chroma .ln", []string{"white-space: pre", "user-select: none", "margin-right: 0.4em", "padding: 0 0.4em"}},
+	{".chroma .lnlinks", []string{"color: inherit", "text-decoration: none"}},
+	{".chroma .lnlinks:hover", []string{"text-decoration: underline"}},
+}
+
+// themeRules converts a chroma style into rules for the .chroma wrapper and
+// its token classes under scope. Tokens keep only their text styling, so the
+// wrapper's background shows through, except for highlighted lines.
+func themeRules(style *chroma.Style, scope string) []cssRule {
+	background := style.Get(chroma.Background)
+	colour, bg := background.Colour, background.Background
+	if !bg.IsSet() {
+		bg = chroma.MustParseColour("#ffffff")
+	}
+	if !colour.IsSet() {
+		colour = chroma.MustParseColour("#000000")
+		if bg.Brightness() < 0.5 {
+			colour = chroma.MustParseColour("#ffffff")
+		}
+	}
+	rules := []cssRule{{
+		selector:     scope + " .chroma",
+		declarations: []string{"color: " + colour.String(), "background-color: " + bg.String()},
+	}}
+
+	types := make([]chroma.TokenType, 0, len(chroma.StandardTypes))
+	for tt := range chroma.StandardTypes {
+		types = append(types, tt)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	for _, tt := range types {
+		class := chroma.StandardTypes[tt]
+		if class == "" || tt == chroma.Background || tt == chroma.PreWrapper {
+			continue
+		}
+		entry := style.Get(tt).Sub(background)
+		var declarations []string
+		if entry.Colour.IsSet() {
+			declarations = append(declarations, "color: "+entry.Colour.String())
+		}
+		if tt == chroma.LineHighlight && entry.Background.IsSet() {
+			declarations = append(declarations, "background-color: "+entry.Background.String())
+		}
+		if entry.Bold == chroma.Yes {
+			declarations = append(declarations, "font-weight: bold")
+		}
+		if entry.Italic == chroma.Yes {
+			declarations = append(declarations, "font-style: italic")
+		}
+		if entry.Underline == chroma.Yes {
+			declarations = append(declarations, "text-decoration: underline")
+		}
+		if len(declarations) == 0 {
+			continue
+		}
+		rules = append(rules, cssRule{
+			selector:     fmt.Sprintf("%s .chroma .%s", scope, class),
+			declarations: declarations,
+		})
+	}
+	return rules
+}
@@ -0,0 +1,44 @@
+package views
+
+import (
+	"binp/util"
+	"strconv"
+	"strings"
+)
+
+func diffLineClass(kind util.DiffKind) string {
+	switch kind {
+	case util.DiffDelete:
+		return "bg-red-900/40"
+	case util.DiffInsert:
+		return "bg-green-900/40"
+	default:
+		return ""
+	}
+}
+
+func diffMarker(kind util.DiffKind) string {
+	switch kind {
+	case util.DiffDelete:
+		return "-"
+	case util.DiffInsert:
+		return "+"
+	default:
+		return " "
+	}
+}
+
+func lineNumber(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// refURL links a diff reference, <id> or <id>@<revision>, to its page.
+func refURL(ref string) string {
+	if id, rev, ok := strings.Cut(ref, "@"); ok {
+		return "/" + id + "/rev/" + rev
+	}
+	return "/" + ref
+}
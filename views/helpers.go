@@ -0,0 +1,144 @@
+package views
+
+import (
+	"binp/storage"
+	"binp/util"
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+
+	"github.com/a-h/templ"
+)
+
+type themeKey struct{}
+
+// WithTheme returns a copy of ctx that renders pages with the named theme.
+func WithTheme(ctx context.Context, theme string) context.Context {
+	return context.WithValue(ctx, themeKey{}, theme)
+}
+
+// ThemeFrom returns the theme pages are rendered with, which is
+// util.ThemeAuto unless WithTheme set another.
+func ThemeFrom(ctx context.Context) string {
+	if theme, ok := ctx.Value(themeKey{}).(string); ok && theme != "" {
+		return theme
+	}
+	return util.ThemeAuto
+}
+
+type baseURLKey struct{}
+
+// WithBaseURL returns a copy of ctx whose pages link to themselves under
+// url, for meta tags that need absolute URLs.
+func WithBaseURL(ctx context.Context, url string) context.Context {
+	return context.WithValue(ctx, baseURLKey{}, url)
+}
+
+// BaseURLFrom returns the URL set by WithBaseURL, or "".
+func BaseURLFrom(ctx context.Context) string {
+	url, _ := ctx.Value(baseURLKey{}).(string)
+	return url
+}
+
+// themeStylesheet is the URL of the CSS of a theme that chroma.css was not
+// generated with, or "" if it was.
+func themeStylesheet(theme string) string {
+	if theme == util.ThemeAuto || slices.Contains(util.Themes(), theme) {
+		return ""
+	}
+	return "/themes/" + url.PathEscape(theme) + ".css"
+}
+
+// bodyClass turns on the dark variants of the page for dark themes.
+func bodyClass(theme string) string {
+	class := "bg-white dark:bg-gray-900 text-black dark:text-white flex min-h-screen h-screen"
+	if util.IsDarkTheme(theme) {
+		class = "dark " + class
+	}
+	return class
+}
+
+// themeOptions lists the themes offered by the theme picker.
+func themeOptions() []storage.SelectOption {
+	var options []storage.SelectOption
+	for _, name := range util.ThemeNames() {
+		label := name
+		if name == util.ThemeAuto {
+			label = "Theme: auto"
+		}
+		options = append(options, storage.SelectOption{Label: label, Value: name})
+	}
+	return options
+}
+
+// languagePickerAttrs adds the attributes of the language field to attrs.
+func languagePickerAttrs(selected string, attrs templ.Attributes) templ.Attributes {
+	merged := templ.Attributes{
+		"name":         "language",
+		"list":         "language-options",
+		"value":        selected,
+		"placeholder":  "Language (auto-detect)",
+		"autocomplete": "off",
+		"spellcheck":   "false",
+	}
+	for key, value := range attrs {
+		merged[key] = value
+	}
+	return merged
+}
+
+// forkLanguage is the language preselected in the editor.
+func forkLanguage(fork *storage.Snippet) string {
+	if fork == nil {
+		return ""
+	}
+	return fork.Language
+}
+
+// fileURL links to a file of a multi-file snippet under prefix, like /raw.
+func fileURL(prefix string, id string, name string) string {
+	return prefix + "/" + id + "/" + url.PathEscape(name)
+}
+
+// fileAnchor is the fragment identifying a file on the snippet page.
+func fileAnchor(name string) string {
+	return "file-" + name
+}
+
+// formatSize formats a size in bytes for display.
+func formatSize(size int) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%d bytes", size)
+	}
+}
+
+// canViewAs reports whether a snippet can be fetched again to view it as
+// another language.
+func canViewAs(snippet *storage.Snippet) bool {
+	return !snippet.BurnAfterRead && !snippet.IsProtected() && !snippet.IsEncrypted() && !snippet.IsBinary() && len(snippet.Files) == 0
+}
+
+// snippetTitle names a snippet in link previews.
+func snippetTitle(snippet *storage.Snippet) string {
+	name := snippet.Filename
+	if len(snippet.Files) > 0 {
+		name = snippet.Files[0].Name
+	}
+	if name == "" {
+		name = snippet.ID
+	}
+	return name + " (" + storage.LanguageLabel(snippet.Language) + ") - binp"
+}
+
+// hasPreview reports whether a snippet gets a preview image. Burn-after-read
+// snippets would be burned by the first site to unfurl them, and the server
+// cannot draw encrypted snippets or binary files.
+func hasPreview(snippet *storage.Snippet) bool {
+	return !snippet.BurnAfterRead && snippet.PasswordHash == "" && !snippet.IsEncrypted() && !snippet.IsBinary()
+}